@@ -1,10 +1,13 @@
 package barrel
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 // Trigger tells whether rotation should be done or not.
@@ -21,6 +24,26 @@ type Rotator interface {
 	Rotate(w io.Writer) (io.Writer, error)
 }
 
+// NoSpacePolicy describes what RollingWriter does when the underlying Writer
+// fails because no space is left on the device.
+type NoSpacePolicy int
+
+const (
+	// NoSpaceFail returns the error to the caller.
+	NoSpaceFail NoSpacePolicy = iota
+
+	// NoSpaceDrop discards the bytes and reports them as written.
+	NoSpaceDrop
+
+	// NoSpaceSpool buffers the bytes in memory, up to the SpoolSize, and
+	// writes them out before the next write.
+	NoSpaceSpool
+
+	// NoSpaceBlock retries the write every BlockInterval until it succeeds or
+	// the writer is closed.
+	NoSpaceBlock
+)
+
 // RollingWriter wraps an io.Writer, providing mechanisms to check and perform
 // rotation on each write.
 type RollingWriter struct {
@@ -33,10 +56,26 @@ type RollingWriter struct {
 	// Rotator used to change the Writer.
 	Rotator
 
+	// NoSpace defines the behaviour of Write when the underlying Writer fails
+	// with syscall.ENOSPC. If unset, it will correspond to NoSpaceFail.
+	NoSpace NoSpacePolicy
+
+	// SpoolSize is the max number of bytes buffered in memory with
+	// NoSpaceSpool. Writes which do not fit in the spool fail.
+	SpoolSize int
+
+	// BlockInterval is the interval between retries with NoSpaceBlock. If
+	// unset, it will correspond to 1 second.
+	BlockInterval time.Duration
+
 	// Serializes access to underlying Writer, Trigger and Rotator but does not
 	// serialize the actual Write calls.
 	mu sync.Mutex
 
+	// Serializes access to the spool used with NoSpaceSpool.
+	spoolMu sync.Mutex
+	spool   []byte
+
 	// Tells whether closed or not.
 	closed int32
 }
@@ -49,6 +88,9 @@ type RollingWriter struct {
 //
 // If Trigger.Trigger returns false the bytes are immediately written to current
 // Writer.
+//
+// If the Writer fails because no space is left on the device, the bytes are
+// handled as described by the NoSpace policy.
 func (w *RollingWriter) Write(p []byte) (int, error) {
 	if w.isClosed() {
 		return 0, ErrClosed
@@ -60,8 +102,9 @@ func (w *RollingWriter) Write(p []byte) (int, error) {
 		return 0, fmt.Errorf("trigger: %w", err)
 	}
 	if !trigger {
+		writer := w.Writer
 		w.mu.Unlock()
-		return w.Writer.Write(p)
+		return w.write(writer, p)
 	}
 	newWriter, err := w.Rotator.Rotate(w.Writer)
 	if err != nil {
@@ -70,7 +113,82 @@ func (w *RollingWriter) Write(p []byte) (int, error) {
 	}
 	w.Writer = newWriter
 	w.mu.Unlock()
-	return w.Writer.Write(p)
+	return w.write(newWriter, p)
+}
+
+// write writes the given bytes to the given writer, handling the failures due
+// to no space left on the device as described by NoSpace.
+func (w *RollingWriter) write(writer io.Writer, p []byte) (int, error) {
+	if w.NoSpace == NoSpaceSpool {
+		return w.writeSpool(writer, p)
+	}
+	n, err := writer.Write(p)
+	if err == nil || !errors.Is(err, syscall.ENOSPC) {
+		return n, err
+	}
+	switch w.NoSpace {
+	case NoSpaceDrop:
+		return len(p), nil
+	case NoSpaceBlock:
+		return w.writeBlock(writer, p, n)
+	}
+	return n, err
+}
+
+func (w *RollingWriter) writeSpool(writer io.Writer, p []byte) (int, error) {
+	w.spoolMu.Lock()
+	defer w.spoolMu.Unlock()
+	if err := w.flushSpool(writer); err != nil {
+		if !errors.Is(err, syscall.ENOSPC) {
+			return 0, err
+		}
+		return w.appendSpool(p, err)
+	}
+	n, err := writer.Write(p)
+	if err == nil || !errors.Is(err, syscall.ENOSPC) {
+		return n, err
+	}
+	nn, err := w.appendSpool(p[n:], err)
+	return n + nn, err
+}
+
+func (w *RollingWriter) appendSpool(p []byte, err error) (int, error) {
+	if len(w.spool)+len(p) > w.SpoolSize {
+		return 0, fmt.Errorf("spool full: %w", err)
+	}
+	w.spool = append(w.spool, p...)
+	return len(p), nil
+}
+
+func (w *RollingWriter) flushSpool(writer io.Writer) error {
+	if len(w.spool) == 0 {
+		return nil
+	}
+	n, err := writer.Write(w.spool)
+	w.spool = w.spool[:copy(w.spool, w.spool[n:])]
+	if err != nil {
+		return fmt.Errorf("flush spool: %w", err)
+	}
+	return nil
+}
+
+func (w *RollingWriter) writeBlock(writer io.Writer, p []byte, written int) (int, error) {
+	interval := w.BlockInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	for written < len(p) {
+		time.Sleep(interval)
+		if w.isClosed() {
+			return written, ErrClosed
+		}
+		n, err := writer.Write(p[written:])
+		written += n
+		if err != nil && !errors.Is(err, syscall.ENOSPC) {
+			return written, err
+		}
+	}
+	return written, nil
 }
 
 // Close closes the RollingWriter.
@@ -85,10 +203,15 @@ func (w *RollingWriter) close() error {
 	defer atomic.StoreInt32(&w.closed, 1)
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	w.spoolMu.Lock()
+	flushErr := w.flushSpool(w.Writer)
+	w.spoolMu.Unlock()
 	if wc, ok := w.Writer.(io.Closer); ok {
-		return wc.Close()
+		if err := wc.Close(); err != nil {
+			return err
+		}
 	}
-	return nil
+	return flushErr
 }
 
 func (w *RollingWriter) isClosed() bool {
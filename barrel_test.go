@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 )
@@ -128,6 +130,100 @@ func TestRollingWriter_Write(t *testing.T) {
 	})
 }
 
+func TestRollingWriter_NoSpace(t *testing.T) {
+	t.Parallel()
+
+	t.Run("fail policy", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		writer := RollingWriter{Writer: &noSpaceWriter{Fails: 1}, Trigger: fixedTrigger(false)}
+
+		_, err := writer.Write([]byte("hello"))
+		r.True(errors.Is(err, syscall.ENOSPC)) // error should wrap ENOSPC
+	})
+
+	t.Run("drop policy", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		w := &noSpaceWriter{Fails: 1}
+		writer := RollingWriter{Writer: w, Trigger: fixedTrigger(false), NoSpace: NoSpaceDrop}
+
+		n, err := writer.Write([]byte("hello"))
+		r.NoErr(err)   // should not be any error
+		r.True(n == 5) // bytes should be reported as written
+
+		n, err = writer.Write([]byte("world"))
+		r.NoErr(err)                     // should not be any error
+		r.True(n == 5)                   // all bytes should be written
+		r.Equal(w.buf.String(), "world") // dropped bytes should not be written
+	})
+
+	t.Run("spool policy", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		w := &noSpaceWriter{Fails: 2}
+		writer := RollingWriter{Writer: w, Trigger: fixedTrigger(false), NoSpace: NoSpaceSpool, SpoolSize: 10}
+
+		n, err := writer.Write([]byte("hello"))
+		r.NoErr(err)   // should not be any error
+		r.True(n == 5) // bytes should be spooled
+
+		n, err = writer.Write([]byte(" "))
+		r.NoErr(err)   // should not be any error
+		r.True(n == 1) // bytes should be spooled
+
+		n, err = writer.Write([]byte("world"))
+		r.NoErr(err)                           // should not be any error
+		r.True(n == 5)                         // all bytes should be written
+		r.Equal(w.buf.String(), "hello world") // spooled bytes should be written in order
+	})
+
+	t.Run("spool policy with full spool", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		w := &noSpaceWriter{Fails: 2}
+		writer := RollingWriter{Writer: w, Trigger: fixedTrigger(false), NoSpace: NoSpaceSpool, SpoolSize: 5}
+
+		_, err := writer.Write([]byte("hello"))
+		r.NoErr(err) // should not be any error
+
+		_, err = writer.Write([]byte("world"))
+		r.True(errors.Is(err, syscall.ENOSPC)) // error should wrap ENOSPC
+	})
+
+	t.Run("spool policy flushes on close", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		w := &noSpaceWriter{Fails: 1}
+		writer := RollingWriter{Writer: w, Trigger: fixedTrigger(false), NoSpace: NoSpaceSpool, SpoolSize: 10}
+
+		_, err := writer.Write([]byte("hello"))
+		r.NoErr(err) // should not be any error
+
+		err = writer.Close()
+		r.NoErr(err)                     // should not be any error
+		r.Equal(w.buf.String(), "hello") // spooled bytes should be written
+	})
+
+	t.Run("block policy", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		w := &noSpaceWriter{Fails: 3}
+		writer := RollingWriter{Writer: w, Trigger: fixedTrigger(false), NoSpace: NoSpaceBlock, BlockInterval: time.Millisecond}
+
+		n, err := writer.Write([]byte("hello"))
+		r.NoErr(err)                     // should not be any error
+		r.True(n == 5)                   // all bytes should be written
+		r.Equal(w.buf.String(), "hello") // bytes should be written once space is available
+	})
+}
+
 func TestRollingWriter_Close(t *testing.T) {
 	t.Parallel()
 
@@ -221,6 +317,21 @@ type writeCloser struct {
 	io.Closer
 }
 
+// noSpaceWriter fails with syscall.ENOSPC for the first Fails writes.
+type noSpaceWriter struct {
+	Fails int
+
+	buf bytes.Buffer
+}
+
+func (w *noSpaceWriter) Write(p []byte) (int, error) {
+	if w.Fails > 0 {
+		w.Fails--
+		return 0, syscall.ENOSPC
+	}
+	return w.buf.Write(p)
+}
+
 type faultyWriter struct {
 	Err error
 }
@@ -5,6 +5,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/hemantjadon/barrel"
 )
 
 // TriggerAdapter wraps the given barrelfile.Trigger in a barrel.Trigger.
@@ -13,16 +16,31 @@ type TriggerAdapter struct {
 }
 
 // Trigger triggers the underlying FileTrigger, if the provided io.Writer is a
-// reference to os.File. Errors and values form underlying FileTrigger are
-// returned directly.
+// reference to os.File or CompressedFile. Errors and values form underlying
+// FileTrigger are returned directly.
+//
+// For a CompressedFile, a SizeBasedTrigger limiting the Uncompressed size is
+// given the uncompressed size of the file instead, and a LineBasedTrigger
+// counts the records in the decompressed file.
 //
 // If the provided writer is not an io.Writer, then a non-nil error is returned.
 func (t TriggerAdapter) Trigger(w io.Writer, p []byte) (bool, error) {
-	file, ok := w.(*os.File)
-	if !ok {
-		return false, fmt.Errorf("writer not reference to os.File")
+	switch file := w.(type) {
+	case *os.File:
+		return t.FileTrigger.Trigger(file.Name(), p)
+	case *CompressedFile:
+		if ct, ok := t.FileTrigger.(compressedFileTrigger); ok {
+			return ct.triggerCompressedFile(file, p)
+		}
+		return t.FileTrigger.Trigger(file.Name(), p)
 	}
-	return t.FileTrigger.Trigger(file.Name(), p)
+	return false, fmt.Errorf("writer not reference to os.File")
+}
+
+// compressedFileTrigger is implemented by triggers which trigger differently
+// for a CompressedFile.
+type compressedFileTrigger interface {
+	triggerCompressedFile(file *CompressedFile, p []byte) (bool, error)
 }
 
 // RotatorAdapter wraps the given barrelfile.Trigger in a barrel.Trigger.
@@ -33,6 +51,11 @@ type RotatorAdapter struct {
 	// Flag to be used to Open the the new file, os.O_CREATE is added
 	// automatically.
 	OpenFlag int
+
+	// Codec used to compress the new file on the fly, by wrapping it in a
+	// CompressedFile. If unset, the new file is compressed with the codec of
+	// the rotated CompressedFile, if any, otherwise it is not compressed.
+	Codec Codec
 }
 
 // Rotate rotates the given writer using the underlying FileRotator, if the
@@ -47,21 +70,39 @@ type RotatorAdapter struct {
 // While opening the file at path returned by FileRotator, given OpenFlag are
 // used, while os.O_CREATE is added in addition to given flags.
 //
+// The provided writer may also be a CompressedFile, whose compressed stream is
+// finalized before rotation. The new file is wrapped in a CompressedFile with
+// the Codec, or with the codec and flush settings of the rotated
+// CompressedFile.
+//
 // If the provided writer is not an io.Writer, then a non-nil error is returned.
 func (r RotatorAdapter) Rotate(w io.Writer) (io.Writer, error) {
-	file, ok := w.(*os.File)
-	if !ok {
+	var file *os.File
+	var compressed *CompressedFile
+	switch f := w.(type) {
+	case *os.File:
+		file = f
+	case *CompressedFile:
+		file = f.File()
+		compressed = f
+	default:
 		return w, fmt.Errorf("writer not reference to os.File")
 	}
 	stat, err := file.Stat()
 	if err != nil {
 		return w, fmt.Errorf("stat current file: %w", err)
 	}
-	if err := file.Sync(); err != nil {
-		return w, fmt.Errorf("sync current file: %w", err)
-	}
-	if err := file.Close(); err != nil {
-		return w, fmt.Errorf("close current file: %w", err)
+	if compressed != nil {
+		if err := compressed.Close(); err != nil {
+			return w, fmt.Errorf("close current compressed file: %w", err)
+		}
+	} else {
+		if err := file.Sync(); err != nil {
+			return w, fmt.Errorf("sync current file: %w", err)
+		}
+		if err := file.Close(); err != nil {
+			return w, fmt.Errorf("close current file: %w", err)
+		}
 	}
 	absFilePath, err := filepath.Abs(file.Name())
 	if err != nil {
@@ -79,5 +120,170 @@ func (r RotatorAdapter) Rotate(w io.Writer) (io.Writer, error) {
 	if err != nil {
 		return nil, fmt.Errorf("open new file: %w", err)
 	}
+	codec := r.Codec
+	if codec == nil && compressed != nil {
+		codec = compressed.Codec()
+	}
+	if codec == nil {
+		return newFile, nil
+	}
+	newCompressed, err := NewCompressedFile(newFile, codec)
+	if err != nil {
+		_ = newFile.Close()
+		return nil, fmt.Errorf("new compressed file: %w", err)
+	}
+	if compressed != nil {
+		newCompressed.FlushBytes = compressed.FlushBytes
+		newCompressed.FlushInterval = compressed.FlushInterval
+		newCompressed.NowFunc = compressed.NowFunc
+	}
+	return newCompressed, nil
+}
+
+// ReopenAdapter wraps the given barrel.Trigger and barrel.Rotator, and reopens
+// the file at its path when it has been moved, deleted or truncated by
+// another process, similar to `tail -F`. It must be used as both the Trigger
+// and the Rotator of the barrel.RollingWriter.
+type ReopenAdapter struct {
+	// BaseTrigger used when the file does not need to be reopened. If nil, no
+	// rotation is triggered.
+	BaseTrigger barrel.Trigger
+
+	// BaseRotator used for rotations triggered by the BaseTrigger.
+	BaseRotator barrel.Rotator
+
+	// Flag to be used to reopen the file, os.O_CREATE is added automatically.
+	OpenFlag int
+
+	// CheckInterval rate limits the checks of the file at path. If unset, it
+	// will correspond to 1 second.
+	CheckInterval time.Duration
+
+	// NowFunc to wrap stdlib time.Now for testing.
+	NowFunc func() time.Time
+
+	checkedAt time.Time
+	checked   os.FileInfo
+	size      int64
+	reopen    bool
+}
+
+var (
+	_ barrel.Trigger = (*ReopenAdapter)(nil)
+	_ barrel.Rotator = (*ReopenAdapter)(nil)
+)
+
+// Trigger compares the open file with the file at its path, at most once per
+// CheckInterval, and returns true if the path no longer refers to the open
+// file, or the open file has shrunk since the last check. The following call
+// to Rotate then reopens the file at path.
+//
+// Otherwise, values and errors from underlying BaseTrigger are returned
+// directly.
+//
+// If the provided writer is not a reference to os.File, or there is any error
+// while checking file stats, then a non-nil error is returned.
+func (a *ReopenAdapter) Trigger(w io.Writer, p []byte) (bool, error) {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false, fmt.Errorf("writer not reference to os.File")
+	}
+	reopen, err := a.check(file)
+	if err != nil {
+		return false, err
+	}
+	if reopen {
+		a.reopen = true
+		return true, nil
+	}
+	if a.BaseTrigger == nil {
+		return false, nil
+	}
+	return a.BaseTrigger.Trigger(w, p)
+}
+
+func (a *ReopenAdapter) check(file *os.File) (bool, error) {
+	var nowTime time.Time
+	if a.NowFunc != nil {
+		nowTime = a.NowFunc()
+	} else {
+		nowTime = time.Now()
+	}
+	interval := a.CheckInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	if !a.checkedAt.IsZero() && nowTime.Sub(a.checkedAt) < interval {
+		return false, nil
+	}
+	a.checkedAt = nowTime
+
+	fileStat, err := file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("stat current file: %w", err)
+	}
+	pathStat, err := os.Stat(file.Name())
+	if err != nil && os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("os stat: %w", err)
+	}
+	if !os.SameFile(fileStat, pathStat) {
+		return true, nil
+	}
+	// sizes are compared only for the file seen by the last check, as the
+	// file may have been replaced by a rotation since.
+	truncated := a.checked != nil && os.SameFile(fileStat, a.checked) && fileStat.Size() < a.size
+	a.checked = fileStat
+	a.size = fileStat.Size()
+	return truncated, nil
+}
+
+// Rotate reopens the file at path of the provided writer, if the preceding
+// call to Trigger found that the file has been moved, deleted or truncated.
+// The provided os.File is closed and the file at its path is opened with the
+// given OpenFlag and os.O_CREATE, using mode of the original file.
+//
+// Otherwise, values and errors from underlying BaseRotator are returned
+// directly, and the file returned by the BaseRotator is checked from then on.
+//
+// If the provided writer is not a reference to os.File, then a non-nil error
+// is returned.
+func (a *ReopenAdapter) Rotate(w io.Writer) (io.Writer, error) {
+	if !a.reopen {
+		newWriter, err := a.BaseRotator.Rotate(w)
+		a.checked = nil
+		a.size = 0
+		if newFile, ok := newWriter.(*os.File); ok && err == nil {
+			if newStat, err := newFile.Stat(); err == nil {
+				a.checked = newStat
+				a.size = newStat.Size()
+			}
+		}
+		return newWriter, err
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return w, fmt.Errorf("writer not reference to os.File")
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return w, fmt.Errorf("stat current file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return w, fmt.Errorf("close current file: %w", err)
+	}
+	a.reopen = false
+	newFile, err := os.OpenFile(file.Name(), os.O_CREATE|a.OpenFlag, stat.Mode())
+	if err != nil {
+		return nil, fmt.Errorf("open new file: %w", err)
+	}
+	newStat, err := newFile.Stat()
+	if err != nil {
+		return newFile, fmt.Errorf("stat new file: %w", err)
+	}
+	a.checked = newStat
+	a.size = newStat.Size()
 	return newFile, nil
 }
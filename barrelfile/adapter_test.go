@@ -2,10 +2,15 @@ package barrelfile
 
 import (
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 )
@@ -155,3 +160,347 @@ func TestRotatorAdapter_Rotate(t *testing.T) {
 		r.True(newFile.Name() == newPath) // new file name should be same as given by FileRotator.
 	})
 }
+
+func TestAdapters_CompressedFile(t *testing.T) {
+	t.Parallel()
+
+	t.Run("trigger with compressed file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+
+		file, err := os.Create(filepath.Join(dir, "application.log.gz"))
+		r.NoErr(err) // should not be any error
+		cf, err := NewCompressedFile(file, GzipCodec{})
+		r.NoErr(err) // should not be any error
+		t.Cleanup(func() { _ = cf.Close() })
+
+		_, err = cf.Write(bytes.Repeat([]byte("a"), 1000))
+		r.NoErr(err) // should not be any error
+
+		v, err := TriggerAdapter{FileTrigger: SizeBasedTrigger{Size: 500}}.Trigger(cf, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // compressed size should be within limit
+
+		v, err = TriggerAdapter{FileTrigger: SizeBasedTrigger{Size: 500, Uncompressed: true}}.Trigger(cf, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // uncompressed size should exceed limit
+
+		v, err = TriggerAdapter{FileTrigger: fixedTrigger(true)}.Trigger(cf, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // other triggers should be triggered with path
+	})
+
+	t.Run("line trigger with compressed file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+
+		file, err := os.Create(filepath.Join(dir, "application.log.gz"))
+		r.NoErr(err) // should not be any error
+		cf, err := NewCompressedFile(file, GzipCodec{})
+		r.NoErr(err) // should not be any error
+		t.Cleanup(func() { _ = cf.Close() })
+
+		_, err = cf.Write(bytes.Repeat([]byte("a\n"), 3))
+		r.NoErr(err) // should not be any error
+
+		trigger := TriggerAdapter{FileTrigger: &LineBasedTrigger{Lines: 4}}
+
+		v, err := trigger.Trigger(cf, []byte("a\n"))
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // records in decompressed file should be counted
+
+		v, err = trigger.Trigger(cf, []byte("a\n"))
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+	})
+
+	t.Run("rotator finalizes compressed file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+
+		path := filepath.Join(dir, "application.log.gz")
+		file, err := os.Create(path)
+		r.NoErr(err) // should not be any error
+		cf, err := NewCompressedFile(file, GzipCodec{})
+		r.NoErr(err) // should not be any error
+		cf.FlushBytes = 1024
+
+		_, err = cf.Write([]byte(testText))
+		r.NoErr(err) // should not be any error
+
+		archivePath := filepath.Join(dir, "application.log.1.gz")
+		rotator := RotatorAdapter{FileRotator: &RotatorMock{RotateFunc: func(path string) (string, error) {
+			return path, os.Rename(path, archivePath)
+		}}, OpenFlag: os.O_WRONLY | os.O_APPEND}
+
+		newWriter, err := rotator.Rotate(cf)
+		r.NoErr(err) // should not be any error
+		newFile, ok := newWriter.(*CompressedFile)
+		r.True(ok) // new writer should be a compressed file
+		t.Cleanup(func() { _ = newFile.Close() })
+		r.Equal(newFile.Name(), path)            // new file should be at original path
+		r.Equal(newFile.FlushBytes, int64(1024)) // flush settings should be kept
+		r.Equal(newFile.Codec().Name(), "gzip")  // codec should be kept
+		r.Equal(newFile.Size(), int64(0))        // new file should be empty
+
+		archive, err := os.Open(archivePath)
+		r.NoErr(err) // should not be any error
+		defer func() { _ = archive.Close() }()
+		gzr, err := gzip.NewReader(archive)
+		r.NoErr(err) // should not be any error
+		content, err := ioutil.ReadAll(gzr)
+		r.NoErr(err)                       // stream of rotated file should be finalized
+		r.Equal(string(content), testText) // decompressed content should be same as written
+	})
+
+	t.Run("rotator starts compressing with codec", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		filePath := NewFile(t, dir, "rotator-adapter-*")
+		file, err := os.OpenFile(filePath, os.O_RDWR|os.O_TRUNC, 0644)
+		r.NoErr(err) // should not be any error
+
+		newPath := fmt.Sprintf("%s-next", filePath)
+		rotatorAdapter := RotatorAdapter{FileRotator: fixedRotator(newPath), OpenFlag: os.O_WRONLY, Codec: ZlibCodec{}}
+
+		newWriter, err := rotatorAdapter.Rotate(file)
+		r.NoErr(err) // should not be any error
+		newFile, ok := newWriter.(*CompressedFile)
+		r.True(ok) // new writer should be a compressed file
+		t.Cleanup(func() {
+			err := newFile.Close()
+			r.NoErr(err) // should not be any error
+
+			err = os.Remove(newFile.Name())
+			r.NoErr(err) // should not be any error
+		})
+		r.Equal(newFile.Codec().Name(), "zlib") // new file should be compressed with given codec
+	})
+}
+
+func TestReopenAdapter(t *testing.T) {
+	t.Parallel()
+
+	// openReopenFile creates a file in a new directory, and opens it for
+	// appending. The file at path is removed on cleanup, if present.
+	openReopenFile := func(t *testing.T) *os.File {
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		path := filepath.Join(dir, "application.log")
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		r.NoErr(err) // should not be any error
+		t.Cleanup(func() {
+			_ = file.Close()
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				t.Fatalf("remove file: %v", err)
+			}
+		})
+		_, err = file.Write([]byte("hello world"))
+		r.NoErr(err) // should not be any error
+		return file
+	}
+
+	t.Run("trigger with non file writer", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		adapter := ReopenAdapter{}
+
+		v, err := adapter.Trigger(&bytes.Buffer{}, nil)
+		r.True(err != nil) // error should be non-nil
+		r.True(v == false)
+	})
+
+	t.Run("unchanged file uses base trigger and rotator", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		file := openReopenFile(t)
+
+		var buf bytes.Buffer
+		adapter := ReopenAdapter{
+			BaseTrigger: TriggerAdapter{FileTrigger: fixedTrigger(true)},
+			BaseRotator: writerRotator{Writer: &buf},
+		}
+
+		v, err := adapter.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // base trigger value should be returned
+
+		newWriter, err := adapter.Rotate(file)
+		r.NoErr(err)              // should not be any error
+		r.True(newWriter == &buf) // writer returned should be given by base rotator
+	})
+
+	t.Run("deleted file is reopened", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		file := openReopenFile(t)
+
+		adapter := ReopenAdapter{
+			BaseTrigger: TriggerAdapter{FileTrigger: fixedTrigger(false)},
+			OpenFlag:    os.O_WRONLY | os.O_APPEND,
+		}
+
+		err := os.Remove(file.Name())
+		r.NoErr(err) // should not be any error
+
+		v, err := adapter.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+
+		newWriter, err := adapter.Rotate(file)
+		r.NoErr(err) // should not be any error
+		newFile, ok := newWriter.(*os.File)
+		r.True(ok) // new writer should be reference to os.File
+		t.Cleanup(func() { _ = newFile.Close() })
+
+		r.True(newFile.Name() == file.Name()) // file at same path should be opened
+		_, err = os.Stat(file.Name())
+		r.NoErr(err) // file should be recreated at path
+	})
+
+	t.Run("moved file is reopened", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		file := openReopenFile(t)
+		movedPath := fmt.Sprintf("%s.1", file.Name())
+		t.Cleanup(func() {
+			err := os.Remove(movedPath)
+			r.NoErr(err) // should not be any error
+		})
+
+		adapter := ReopenAdapter{OpenFlag: os.O_WRONLY | os.O_APPEND}
+
+		err := os.Rename(file.Name(), movedPath)
+		r.NoErr(err) // should not be any error
+		err = ioutil.WriteFile(file.Name(), nil, 0644)
+		r.NoErr(err) // should not be any error
+
+		v, err := adapter.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+
+		newWriter, err := adapter.Rotate(file)
+		r.NoErr(err) // should not be any error
+		newFile := newWriter.(*os.File)
+		t.Cleanup(func() { _ = newFile.Close() })
+
+		_, err = newFile.Write([]byte("after move"))
+		r.NoErr(err) // should not be any error
+
+		data, err := ioutil.ReadFile(file.Name())
+		r.NoErr(err)                        // should not be any error
+		r.Equal(string(data), "after move") // writes should go to the file at path
+	})
+
+	t.Run("truncated file is reopened", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		file := openReopenFile(t)
+
+		clk := clock{}
+		clk.Set(testTime)
+
+		adapter := ReopenAdapter{OpenFlag: os.O_WRONLY | os.O_APPEND, NowFunc: clk.Now}
+
+		v, err := adapter.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+
+		err = os.Truncate(file.Name(), 0)
+		r.NoErr(err) // should not be any error
+
+		// within check interval truncation is not noticed
+		v, err = adapter.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+
+		clk.Set(testTime.Add(time.Minute))
+
+		v, err = adapter.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+
+		newWriter, err := adapter.Rotate(file)
+		r.NoErr(err) // should not be any error
+		newFile := newWriter.(*os.File)
+		t.Cleanup(func() { _ = newFile.Close() })
+	})
+
+	t.Run("base rotation is not mistaken for truncation", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		file := openReopenFile(t)
+		rotatedPath := fmt.Sprintf("%s.1", file.Name())
+		t.Cleanup(func() {
+			err := os.Remove(rotatedPath)
+			r.NoErr(err) // should not be any error
+		})
+
+		clk := clock{}
+		clk.Set(testTime)
+
+		adapter := ReopenAdapter{
+			BaseTrigger: TriggerAdapter{FileTrigger: fixedTrigger(true)},
+			BaseRotator: RotatorAdapter{
+				FileRotator: &RotatorMock{RotateFunc: func(path string) (string, error) {
+					return path, os.Rename(path, rotatedPath)
+				}},
+				OpenFlag: os.O_WRONLY,
+			},
+			OpenFlag: os.O_WRONLY,
+			NowFunc:  clk.Now,
+		}
+
+		v, err := adapter.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // base trigger value should be returned
+
+		newWriter, err := adapter.Rotate(file)
+		r.NoErr(err) // should not be any error
+		newFile := newWriter.(*os.File)
+		t.Cleanup(func() { _ = newFile.Close() })
+
+		_, err = newFile.Write([]byte("hello\n"))
+		r.NoErr(err) // should not be any error
+
+		clk.Set(testTime.Add(time.Minute))
+		adapter.BaseTrigger = TriggerAdapter{FileTrigger: fixedTrigger(false)}
+
+		v, err = adapter.Trigger(newFile, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // new smaller file should not be considered truncated
+
+		_, err = newFile.Write([]byte("AB"))
+		r.NoErr(err) // should not be any error
+
+		data, err := ioutil.ReadFile(file.Name())
+		r.NoErr(err)                       // should not be any error
+		r.Equal(string(data), "hello\nAB") // writes should not overwrite the file
+	})
+}
+
+type writerRotator struct {
+	Writer io.Writer
+}
+
+func (r writerRotator) Rotate(_ io.Writer) (io.Writer, error) {
+	return r.Writer, nil
+}
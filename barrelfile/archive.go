@@ -0,0 +1,179 @@
+package barrelfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Archive describes a file generated by rotation, as parsed from its path.
+type Archive struct {
+	// Path of the archive.
+	Path string
+
+	// Base is the name of the original file without extension, eg.
+	// application.
+	Base string
+
+	// Ext is the extension of the original file, eg. .log.
+	Ext string
+
+	// Suffix is the suffix added to the archive by transformers, eg. .gz.
+	Suffix string
+
+	// Timestamp encoded in the name of the archive. Zero if the name does
+	// not encode a timestamp.
+	Timestamp time.Time
+
+	// Sequence index encoded in the name of the archive.
+	Sequence int
+
+	// ModTime of the archive, set by FindArchives.
+	ModTime time.Time
+
+	// Size of the archive, set by FindArchives.
+	Size int64
+}
+
+// Name returns the name of the original file of the archive, eg.
+// application.log.
+func (a Archive) Name() string {
+	return a.Base + a.Ext
+}
+
+// Time returns the Timestamp of the archive, or the ModTime when the name
+// does not encode a timestamp.
+func (a Archive) Time() time.Time {
+	if a.Timestamp.IsZero() {
+		return a.ModTime
+	}
+	return a.Timestamp
+}
+
+// Parser is the inverse of Namer, it parses the path of an archive back into
+// its metadata.
+//
+// If the path is not of an archive generated by the corresponding Namer then
+// an error wrapping ErrNotArchive is returned.
+type Parser interface {
+	Parse(path string) (Archive, error)
+}
+
+// archiveSuffixes are the suffixes added to archives by transformers, which
+// are not part of the extension of the original file. Extensions of the
+// registered codecs are recognized as well.
+var archiveSuffixes = []string{".gz", ".zz", ".deflate", ".xz", ".zst", ".bz2", ".lz4", EncryptExt}
+
+// sidecarExts are the extensions of sidecar files written next to archives by
+// transformers, added to the name of the archive. Sidecars are not archives
+// themselves, and are removed along with their archive.
+var sidecarExts = []string{GzipIndexExt, SHA256Ext, CRC32CExt}
+
+// isSidecar reports whether the file at the given path is a sidecar file.
+func isSidecar(path string) bool {
+	for _, ext := range sidecarExts {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeSidecars removes the sidecar files of the archive at the given path,
+// if any.
+func removeSidecars(path string) error {
+	for _, ext := range sidecarExts {
+		if err := os.Remove(path + ext); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("os remove sidecar: %w", err)
+		}
+	}
+	return nil
+}
+
+// splitSuffix splits the given extension into the extension of the original
+// file, and the suffixes added by transformers.
+func splitSuffix(ext string) (string, string) {
+	suffixes := append(codecExts(), archiveSuffixes...)
+	suffixStart := len(ext)
+	for {
+		found := false
+		for _, suffix := range suffixes {
+			if len(suffix) != 0 && strings.HasSuffix(ext[:suffixStart], suffix) {
+				suffixStart -= len(suffix)
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return ext[:suffixStart], ext[suffixStart:]
+}
+
+// FindArchives walks the directory at the given path, and returns the archives
+// of the file at current path, as parsed by the provided Parser, ordered from
+// the oldest to the newest.
+//
+// Archives are ordered by their Time, and then by their Sequence, except for
+// archives of ShiftingNamer which are ordered by their Sequence, descending.
+//
+// If there are any errors while walking the directory then non-nil error is
+// returned.
+func FindArchives(dir, current string, parser Parser) ([]Archive, error) {
+	name := filepath.Base(current)
+	absCurrent, err := filepath.Abs(current)
+	if err != nil {
+		return nil, fmt.Errorf("determine current file absolute path: %w", err)
+	}
+
+	var archives []Archive
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || isSidecar(path) {
+			return nil
+		}
+		if absPath, err := filepath.Abs(path); err == nil && absPath == absCurrent {
+			return nil
+		}
+		archive, err := parser.Parse(path)
+		if err != nil || archive.Name() != name {
+			return nil
+		}
+		archive.ModTime = info.ModTime()
+		archive.Size = info.Size()
+		archives = append(archives, archive)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("filepath walk: %w", err)
+	}
+
+	if sorter, ok := parser.(archiveSorter); ok {
+		sorter.sortArchives(archives)
+		return archives, nil
+	}
+	sort.SliceStable(archives, func(i, j int) bool {
+		ti, tj := archives[i].Time(), archives[j].Time()
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return archives[i].Sequence < archives[j].Sequence
+	})
+	return archives, nil
+}
+
+// archiveSorter is implemented by parsers of archives which have an order
+// other than by their time and sequence.
+type archiveSorter interface {
+	// sortArchives sorts the given archives from the oldest to the newest.
+	sortArchives(archives []Archive)
+}
@@ -0,0 +1,92 @@
+package barrelfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestArchive_Time(t *testing.T) {
+	t.Parallel()
+	r := is.New(t)
+
+	archive := Archive{ModTime: testTime}
+	r.True(archive.Time().Equal(testTime)) // mod time should be used without timestamp
+
+	archive.Timestamp = testTime.Add(-time.Hour)
+	r.True(archive.Time().Equal(testTime.Add(-time.Hour))) // timestamp should be preferred
+}
+
+func TestFindArchives(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no directory", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		archives, err := FindArchives(filepath.Join(dir, "missing"), filepath.Join(dir, "application.log"), TimestampSequenceNamer{})
+		r.NoErr(err)               // should not be any error
+		r.True(len(archives) == 0) // no archives should be found
+	})
+
+	t.Run("archives of the file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "data",
+			"application.log",
+			"application_2021-01-02.1.log.gz",
+			"application_2021-01-01.0.log",
+			"application_2021-01-02.0.log.gz",
+			"application_2021-01-02.0.txt",
+			"other_2021-01-02.0.log",
+			"notes.txt",
+		)
+		err := os.Mkdir(filepath.Join(dir, "nested"), 0755)
+		r.NoErr(err) // should not be any error
+		NewFiles(t, filepath.Join(dir, "nested"), "data", "application_2020-12-31.0.log")
+
+		archives, err := FindArchives(dir, filepath.Join(dir, "application.log"), TimestampSequenceNamer{})
+		r.NoErr(err) // should not be any error
+
+		var names []string
+		for _, archive := range archives {
+			r.True(archive.Size == 4) // size should be set
+			names = append(names, archive.Path)
+		}
+		r.Equal(names, []string{
+			filepath.Join(dir, "nested", "application_2020-12-31.0.log"),
+			filepath.Join(dir, "application_2021-01-01.0.log"),
+			filepath.Join(dir, "application_2021-01-02.0.log.gz"),
+			filepath.Join(dir, "application_2021-01-02.1.log.gz"),
+		})
+	})
+}
+
+func TestSplitSuffix(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		in, ext, suffix string
+	}{
+		{in: "", ext: "", suffix: ""},
+		{in: ".log", ext: ".log", suffix: ""},
+		{in: ".log.gz", ext: ".log", suffix: ".gz"},
+		{in: ".tar.gz", ext: ".tar", suffix: ".gz"},
+		{in: ".gz", ext: "", suffix: ".gz"},
+		{in: ".log.zst.gz", ext: ".log", suffix: ".zst.gz"},
+	} {
+		r := is.New(t)
+
+		ext, suffix := splitSuffix(tc.in)
+		r.Equal(ext, tc.ext)
+		r.Equal(suffix, tc.suffix)
+	}
+}
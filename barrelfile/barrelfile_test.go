@@ -3,7 +3,9 @@ package barrelfile
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 //go:generate moq -fmt goimports -out ./barrelfile_test_mock_test.go . Trigger Rotator Transformer Namer
@@ -49,6 +51,71 @@ func NewFile(tb testing.TB, dir, pattern string) (path string) {
 	return file.Name()
 }
 
+// CleanupDir removes all the files in the directory at the given path on
+// cleanup, for tests which create files with names not known upfront.
+func CleanupDir(tb testing.TB, dir string) {
+	tb.Helper()
+
+	tb.Cleanup(func() {
+		fileInfos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			tb.Fatalf("read temp dir: %v", err)
+		}
+		for _, fileInfo := range fileInfos {
+			if err := os.RemoveAll(filepath.Join(dir, fileInfo.Name())); err != nil {
+				tb.Fatalf("remove temp file: %v", err)
+			}
+		}
+	})
+}
+
+// NewFiles creates files with the given names and content in the directory at
+// the given path.
+func NewFiles(tb testing.TB, dir string, content string, names ...string) {
+	tb.Helper()
+
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			tb.Fatalf("write temp file: %v", err)
+		}
+	}
+}
+
+// NewArchives creates the file application.log, the file other.log.1 and the
+// given archives in a new directory, with mtime of each archive increasing in
+// the given order, and returns the path of the directory.
+func NewArchives(tb testing.TB, archives ...string) string {
+	tb.Helper()
+
+	dir := SetupDir(tb)
+	CleanupDir(tb, dir)
+	NewFiles(tb, dir, "current", "application.log", "other.log.1")
+	for i, archive := range archives {
+		NewFiles(tb, dir, "archive", archive)
+		modTime := testTime.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, archive), modTime, modTime); err != nil {
+			tb.Fatalf("change times of archive: %v", err)
+		}
+	}
+	return dir
+}
+
+// DirFiles returns the sorted names of the files in the directory at the
+// given path.
+func DirFiles(tb testing.TB, dir string) []string {
+	tb.Helper()
+
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		tb.Fatalf("read temp dir: %v", err)
+	}
+	var names []string
+	for _, fileInfo := range fileInfos {
+		names = append(names, fileInfo.Name())
+	}
+	return names
+}
+
 func fixedTrigger(value bool) Trigger {
 	return &TriggerMock{
 		TriggerFunc: func(_ string, _ []byte) (bool, error) {
@@ -113,9 +180,18 @@ func faultyNamer(err error) Namer {
 	}
 }
 
+type faultyWriter struct {
+	Err error
+}
+
+func (w faultyWriter) Write(_ []byte) (int, error) {
+	return 0, w.Err
+}
+
 const (
 	errTrigger     testError = "err trigger"
 	errRotator     testError = "err rotator"
 	errTransformer testError = "err transformer"
 	errNamer       testError = "err namer"
+	errWriter      testError = "err writer"
 )
@@ -0,0 +1,22 @@
+package barrelfile
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileBirthTime returns the creation time of the file at the given path as
+// reported by stat(2).
+func fileBirthTime(path string) (time.Time, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("os stat: %w", err)
+	}
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, fmt.Errorf("stat: birth time not reported")
+	}
+	return time.Unix(sys.Birthtimespec.Unix()), nil
+}
@@ -0,0 +1,88 @@
+package barrelfile
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// statxTrap maps GOARCH to the statx(2) system call number, which is not
+// exposed by package syscall for most architectures.
+var statxTrap = map[string]uintptr{
+	"386":      383,
+	"amd64":    332,
+	"arm":      397,
+	"arm64":    291,
+	"loong64":  291,
+	"mips64":   5326,
+	"mips64le": 5326,
+	"ppc64":    383,
+	"ppc64le":  383,
+	"riscv64":  291,
+	"s390x":    379,
+}
+
+const (
+	atFDCWD    = -0x64
+	statxBtime = 0x800
+)
+
+type statxTimestamp struct {
+	Sec  int64
+	Nsec uint32
+	_    int32
+}
+
+type statxBuf struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	UID            uint32
+	GID            uint32
+	Mode           uint16
+	_              uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          statxTimestamp
+	Btime          statxTimestamp
+	Ctime          statxTimestamp
+	Mtime          statxTimestamp
+	_              [16]uint64
+}
+
+// fileBirthTime returns the creation time of the file at the given path using
+// statx(2). If the kernel or the file system does not report the birth time
+// then non-nil error is returned.
+func fileBirthTime(path string) (time.Time, error) {
+	trap, ok := statxTrap[runtime.GOARCH]
+	if !ok {
+		return time.Time{}, fmt.Errorf("statx unsupported on %s", runtime.GOARCH)
+	}
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("byte ptr from string: %w", err)
+	}
+	dirfd := atFDCWD
+	var stx statxBuf
+	_, _, errno := syscall.Syscall6(
+		trap,
+		uintptr(dirfd),
+		uintptr(unsafe.Pointer(p)),
+		0,
+		statxBtime,
+		uintptr(unsafe.Pointer(&stx)),
+		0,
+	)
+	if errno != 0 {
+		return time.Time{}, fmt.Errorf("statx: %w", errno)
+	}
+	if stx.Mask&statxBtime == 0 {
+		return time.Time{}, fmt.Errorf("statx: birth time not reported")
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package barrelfile
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// fileBirthTime always returns a non-nil error as birth time is not supported
+// on this platform.
+func fileBirthTime(_ string) (time.Time, error) {
+	return time.Time{}, fmt.Errorf("birth time unsupported on %s", runtime.GOOS)
+}
@@ -0,0 +1,413 @@
+package barrelfile
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TarExt is the extension of bundles written by BundleTransformer.
+const TarExt = ".tar"
+
+// BundleTransformer bundles the archives of completed windows of time, eg.
+// days, into single tar files, to avoid piling up of many small archives. It
+// is expected to be used after the transformers generating the archive.
+//
+// A bundle is named as base of the file, underscore, window and extension of
+// the file, followed by TarExt, eg. application_2021-01-02.log.tar. If the
+// bundle of a window already exists, then a sequence is added to the window,
+// eg. application_2021-01-02-1.log.tar. Archives and their sidecar files are
+// stored in the bundle with their modes and mtimes, by their paths relative to
+// the Dir. Bundles are not archives of the file, as their extension differs
+// from the extension of the file, so they are not removed by
+// RetentionTransformer, but by MaxBundles and MaxBundleAge instead.
+type BundleTransformer struct {
+	// Parser used to discover the archives of the file, it should correspond
+	// to the Namer generating the archives.
+	Parser Parser
+
+	// Dir is the directory searched, including nested directories, for the
+	// archives, where the bundles are written. If unset, it will correspond to
+	// the directory of the file.
+	Dir string
+
+	// WindowLayout is the time layout of the windows, archives of which are
+	// bundled together, as determined by the Time of the archives in local
+	// time. If unset, it will correspond to "2006-01-02", ie. a day.
+	WindowLayout string
+
+	// Gzip compresses the bundles, adding ".gz" to their names.
+	Gzip bool
+
+	// MaxBundles is the max number of bundles of the file to be kept, the
+	// oldest bundles by mtime are removed. If unset (ie. 0), bundles are not
+	// removed by count.
+	MaxBundles int
+
+	// MaxBundleAge is the max age of bundles of the file to be kept, measured
+	// from their mtime, ie. mtime of their newest archive. If unset (ie. 0),
+	// bundles are not removed by age.
+	MaxBundleAge time.Duration
+
+	// NowFunc to wrap stdlib time.Now for testing.
+	NowFunc func() time.Time
+
+	// Logger logs the written bundles. If unset, nothing is logged.
+	Logger *log.Logger
+}
+
+var _ Transformer = (*BundleTransformer)(nil)
+
+// Transform discovers the archives of the file, which the file at the given
+// path is an archive of, as parsed by the Parser, and bundles the archives of
+// completed windows. If the given path is not of an archive, then it is
+// considered as the file itself. The given path is returned unchanged.
+//
+// The window of the archive at the given path is not bundled, even if it is
+// completed, eg. the archive of a rotation at midnight, so that the archive
+// still exists for the following transformers. It is bundled by the next
+// Transform or Sweep.
+//
+// If there are any errors while discovering or bundling the archives then
+// non-nil error is returned.
+func (t BundleTransformer) Transform(path string) (string, error) {
+	current := path
+	if archive, err := t.Parser.Parse(path); err == nil {
+		current = filepath.Join(filepath.Dir(path), archive.Name())
+	}
+	if err := t.sweep(current, path); err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// Sweep discovers the archives of the file at current path, as parsed by the
+// Parser, and bundles the archives of every completed window, ie. window other
+// than the current one. Each bundle is verified against the archives, before
+// the archives are removed. Then bundles exceeding MaxBundles or MaxBundleAge
+// are removed.
+//
+// If there are any errors while discovering or bundling the archives, or
+// removing the bundles then non-nil error is returned.
+func (t BundleTransformer) Sweep(current string) error {
+	return t.sweep(current, "")
+}
+
+// sweep is Sweep, except that the window of the archive at the skip path, if
+// any, is not bundled.
+func (t BundleTransformer) sweep(current, skip string) error {
+	dir := t.Dir
+	if len(dir) == 0 {
+		dir = filepath.Dir(current)
+	}
+	layout := t.WindowLayout
+	if len(layout) == 0 {
+		layout = "2006-01-02"
+	}
+	var nowTime time.Time
+	if t.NowFunc != nil {
+		nowTime = t.NowFunc()
+	} else {
+		nowTime = time.Now()
+	}
+
+	archives, err := FindArchives(dir, current, t.Parser)
+	if err != nil {
+		return fmt.Errorf("find archives: %w", err)
+	}
+	skipWindows := map[string]bool{nowTime.Local().Format(layout): true}
+	for _, archive := range archives {
+		if len(skip) != 0 && filepath.Clean(archive.Path) == filepath.Clean(skip) {
+			skipWindows[archive.Time().Local().Format(layout)] = true
+		}
+	}
+	var windows []string
+	members := make(map[string][]Archive)
+	for _, archive := range archives {
+		window := archive.Time().Local().Format(layout)
+		if skipWindows[window] {
+			continue
+		}
+		if _, ok := members[window]; !ok {
+			windows = append(windows, window)
+		}
+		members[window] = append(members[window], archive)
+	}
+	sort.Strings(windows)
+
+	name := filepath.Base(current)
+	ext := filepathFullExt(name)
+	base := strings.TrimSuffix(name, ext)
+	for _, window := range windows {
+		bundlePath, err := t.bundle(dir, base+"_"+window, ext, members[window])
+		if err != nil {
+			return fmt.Errorf("bundle window %s: %w", window, err)
+		}
+		logf(t.Logger, "bundle: bundled %d archives into %s", len(members[window]), bundlePath)
+	}
+	if err := t.expire(dir, base, ext, nowTime); err != nil {
+		return fmt.Errorf("expire bundles: %w", err)
+	}
+	return nil
+}
+
+// expire removes the bundles of the file, named by the given base and
+// extension in the directory, exceeding MaxBundles or MaxBundleAge.
+func (t BundleTransformer) expire(dir, base, ext string, nowTime time.Time) error {
+	if t.MaxBundles <= 0 && t.MaxBundleAge <= 0 {
+		return nil
+	}
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read dir: %w", err)
+	}
+	var bundles []os.FileInfo
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if fileInfo.IsDir() || !strings.HasPrefix(name, base+"_") {
+			continue
+		}
+		if strings.HasSuffix(name, ext+TarExt) || strings.HasSuffix(name, ext+TarExt+".gz") {
+			bundles = append(bundles, fileInfo)
+		}
+	}
+	// newest first
+	sort.SliceStable(bundles, func(i, j int) bool {
+		return bundles[i].ModTime().After(bundles[j].ModTime())
+	})
+	for i, bundle := range bundles {
+		expired := (t.MaxBundles > 0 && i >= t.MaxBundles) ||
+			(t.MaxBundleAge > 0 && nowTime.Sub(bundle.ModTime()) > t.MaxBundleAge)
+		if !expired {
+			continue
+		}
+		path := filepath.Join(dir, bundle.Name())
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("os remove bundle: %w", err)
+		}
+		logf(t.Logger, "bundle: removed %s", path)
+	}
+	return nil
+}
+
+// StartSweep runs Sweep for the file at current path every interval in a
+// separate goroutine, until the returned stop function is called. Errors are
+// logged to the Logger.
+func (t BundleTransformer) StartSweep(current string, interval time.Duration) (stop func()) {
+	return startSweep(interval, func() error { return t.Sweep(current) }, t.Logger, "bundle: sweep "+current)
+}
+
+// bundle writes the given archives, and their sidecar files, into a new bundle
+// named by the given prefix and extension in the directory, verifies it, and
+// removes the archives. It returns the path of the bundle.
+func (t BundleTransformer) bundle(dir, prefix, ext string, archives []Archive) (string, error) {
+	var paths []string
+	// bundle is no more accessible than any of its archives.
+	mode := os.ModePerm
+	for _, archive := range archives {
+		stat, err := os.Stat(archive.Path)
+		if err != nil {
+			return "", fmt.Errorf("os stat archive: %w", err)
+		}
+		mode &= stat.Mode().Perm()
+		paths = append(paths, archive.Path)
+		for _, sidecarExt := range sidecarExts {
+			if _, err := os.Stat(archive.Path + sidecarExt); err == nil {
+				paths = append(paths, archive.Path+sidecarExt)
+			}
+		}
+	}
+
+	suffix := ext + TarExt
+	if t.Gzip {
+		suffix += ".gz"
+	}
+	tmp, err := os.OpenFile(filepath.Join(dir, "."+prefix+suffix+".tmp"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return "", fmt.Errorf("os open temp bundle: %w", err)
+	}
+	tmpPath := tmp.Name()
+	// mode of an existing temp bundle, or masked by umask, is set explicitly.
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("chmod temp bundle: %w", err)
+	}
+	if err := writeBundle(tmp, dir, paths, t.Gzip); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("close temp bundle: %w", err)
+	}
+	if err := verifyBundle(tmpPath, dir, paths, t.Gzip); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("verify bundle: %w", err)
+	}
+
+	// bundles are never overwritten, a window bundled before gets another
+	// bundle for its late archives.
+	var bundlePath string
+	for i := 0; ; i++ {
+		name := prefix + suffix
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d%s", prefix, i, suffix)
+		}
+		bundlePath = filepath.Join(dir, name)
+		err := inodeRename(tmpPath, bundlePath)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			_ = os.Remove(tmpPath)
+			return "", fmt.Errorf("rename temp bundle: %w", err)
+		}
+	}
+	newest := archives[len(archives)-1].ModTime
+	if err := os.Chtimes(bundlePath, newest, newest); err != nil {
+		return "", fmt.Errorf("os change times bundle: %w", err)
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("os remove archive: %w", err)
+		}
+	}
+	return bundlePath, nil
+}
+
+// writeBundle writes the files at the given paths into a tar, optionally
+// gzipped, to the given file, and syncs it. Names of the files in the tar are
+// their paths relative to the directory.
+func writeBundle(file *os.File, dir string, paths []string, gz bool) error {
+	var w io.Writer = file
+	var gzw *gzip.Writer
+	if gz {
+		gzw = gzip.NewWriter(file)
+		w = gzw
+	}
+	tw := tar.NewWriter(w)
+	for _, path := range paths {
+		if err := writeBundleMember(tw, dir, path); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("close tar writer: %w", err)
+	}
+	if gzw != nil {
+		if err := gzw.Close(); err != nil {
+			return fmt.Errorf("close gzip writer: %w", err)
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync bundle: %w", err)
+	}
+	return nil
+}
+
+func writeBundleMember(tw *tar.Writer, dir, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("os open archive: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("os stat archive: %w", err)
+	}
+	hdr, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return fmt.Errorf("tar header: %w", err)
+	}
+	name, err := filepath.Rel(dir, path)
+	if err != nil {
+		return fmt.Errorf("determine archive path relative to dir: %w", err)
+	}
+	hdr.Name = filepath.ToSlash(name)
+	// PAX format keeps sub-second mtimes.
+	hdr.Format = tar.FormatPAX
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write tar header: %w", err)
+	}
+	if _, err := io.Copy(tw, file); err != nil {
+		return fmt.Errorf("write archive to tar: %w", err)
+	}
+	return nil
+}
+
+// verifyBundle reads the bundle at the given path, and verifies that it holds
+// exactly the files at the given paths, with their content, mode and mtime.
+func verifyBundle(bundle, dir string, paths []string, gz bool) error {
+	file, err := os.Open(bundle)
+	if err != nil {
+		return fmt.Errorf("os open bundle: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	var r io.Reader = file
+	if gz {
+		gzr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("gzip new reader: %w", err)
+		}
+		r = gzr
+	}
+
+	tr := tar.NewReader(r)
+	for _, path := range paths {
+		hdr, err := tr.Next()
+		if err != nil {
+			return fmt.Errorf("read tar header: %w", err)
+		}
+		name, _ := filepath.Rel(dir, path)
+		if hdr.Name != filepath.ToSlash(name) {
+			return fmt.Errorf("unexpected member %s", hdr.Name)
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("os stat archive: %w", err)
+		}
+		if hdr.FileInfo().Mode() != stat.Mode() || !hdr.ModTime.Equal(stat.ModTime()) {
+			return fmt.Errorf("mode or mtime of %s does not match", hdr.Name)
+		}
+		bundled := sha256.New()
+		if _, err := io.Copy(bundled, tr); err != nil {
+			return fmt.Errorf("read tar member: %w", err)
+		}
+		original := sha256.New()
+		if err := copyFile(original, path); err != nil {
+			return err
+		}
+		if !bytes.Equal(bundled.Sum(nil), original.Sum(nil)) {
+			return fmt.Errorf("content of %s does not match", hdr.Name)
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		return fmt.Errorf("unexpected members at end")
+	}
+	return nil
+}
+
+func copyFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("os open archive: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("read archive: %w", err)
+	}
+	return nil
+}
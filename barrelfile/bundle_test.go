@@ -0,0 +1,256 @@
+package barrelfile
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestBundleTransformer_Transform(t *testing.T) {
+	t.Parallel()
+
+	// setupArchives creates the file and its archives in a new directory, with
+	// mtime of each archive as its timestamp.
+	setupArchives := func(t *testing.T, archives ...string) string {
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+		for i, archive := range archives {
+			NewFiles(t, dir, "content of "+archive, archive)
+			parsed, err := TimestampSequenceNamer{TimestampFormat: "2006-01-02T15-04"}.Parse(archive)
+			r.NoErr(err) // should not be any error
+			err = os.Chtimes(filepath.Join(dir, archive), parsed.Timestamp, parsed.Timestamp)
+			r.NoErr(err) // should not be any error
+			err = os.Chmod(filepath.Join(dir, archive), os.FileMode(0600+i*0x20))
+			r.NoErr(err) // should not be any error
+		}
+		return dir
+	}
+
+	// readBundle returns the headers of the members of the bundle by name, and
+	// checks their content.
+	readBundle := func(t *testing.T, path string, gz bool) map[string]*tar.Header {
+		r := is.New(t)
+
+		file, err := os.Open(path)
+		r.NoErr(err) // should not be any error
+		defer func() { _ = file.Close() }()
+		var rd io.Reader = file
+		if gz {
+			rd, err = gzip.NewReader(file)
+			r.NoErr(err) // should not be any error
+		}
+		members := make(map[string]*tar.Header)
+		tr := tar.NewReader(rd)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			r.NoErr(err) // should not be any error
+			content, err := ioutil.ReadAll(tr)
+			r.NoErr(err)                                     // should not be any error
+			r.Equal(string(content), "content of "+hdr.Name) // member should have content of archive
+			members[hdr.Name] = hdr
+		}
+		return members
+	}
+
+	archives := []string{
+		"application_2021-01-01T10-00.0.log",
+		"application_2021-01-01T11-00.0.log",
+		"application_2021-01-02T10-00.0.log",
+		"application_2021-01-03T10-00.0.log",
+	}
+
+	t.Run("completed windows are bundled", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := setupArchives(t, archives...)
+		// stats before bundling, to compare with members
+		stats := make(map[string]os.FileInfo)
+		for _, archive := range archives {
+			stat, err := os.Stat(filepath.Join(dir, archive))
+			r.NoErr(err) // should not be any error
+			stats[archive] = stat
+		}
+
+		clk := clock{}
+		clk.Set(time.Date(2021, 1, 3, 12, 0, 0, 0, time.Local))
+
+		var logs bytes.Buffer
+		transformer := BundleTransformer{
+			Parser:  TimestampSequenceNamer{TimestampFormat: "2006-01-02T15-04"},
+			NowFunc: clk.Now,
+			Logger:  log.New(&logs, "", 0),
+		}
+
+		path, err := transformer.Transform(filepath.Join(dir, archives[3]))
+		r.NoErr(err)                                   // should not be any error
+		r.Equal(path, filepath.Join(dir, archives[3])) // path should be unchanged
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application_2021-01-01.log.tar",
+			"application_2021-01-02.log.tar",
+			"application_2021-01-03T10-00.0.log",
+		})
+		r.True(strings.Contains(logs.String(), "bundled 2 archives into "+filepath.Join(dir, "application_2021-01-01.log.tar"))) // bundle should be logged
+
+		members := readBundle(t, filepath.Join(dir, "application_2021-01-01.log.tar"), false)
+		r.Equal(len(members), 2) // archives of the window should be bundled
+		for _, archive := range archives[:2] {
+			hdr, ok := members[archive]
+			r.True(ok)                                            // archive should be a member
+			r.Equal(hdr.FileInfo().Mode(), stats[archive].Mode()) // mode should be preserved
+			r.True(hdr.ModTime.Equal(stats[archive].ModTime()))   // mtime should be preserved
+		}
+
+		stat, err := os.Stat(filepath.Join(dir, "application_2021-01-01.log.tar"))
+		r.NoErr(err)                                               // should not be any error
+		r.True(stat.ModTime().Equal(stats[archives[1]].ModTime())) // bundle mtime should be of newest archive
+		r.Equal(stat.Mode().Perm(), os.FileMode(0600))             // bundle mode should be derived from archives
+	})
+
+	t.Run("gzipped bundle with sidecars", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := setupArchives(t, archives[:2]...)
+		NewFiles(t, dir, "content of application_2021-01-01T10-00.0.log.sha256", "application_2021-01-01T10-00.0.log.sha256")
+
+		clk := clock{}
+		clk.Set(time.Date(2021, 1, 2, 0, 0, 0, 0, time.Local))
+		transformer := BundleTransformer{
+			Parser:  TimestampSequenceNamer{TimestampFormat: "2006-01-02T15-04"},
+			Gzip:    true,
+			NowFunc: clk.Now,
+		}
+
+		err := transformer.Sweep(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application_2021-01-01.log.tar.gz"})
+
+		members := readBundle(t, filepath.Join(dir, "application_2021-01-01.log.tar.gz"), true)
+		r.Equal(len(members), 3) // archives and sidecar should be bundled
+		_, ok := members["application_2021-01-01T10-00.0.log.sha256"]
+		r.True(ok) // sidecar should be a member
+	})
+
+	t.Run("late archives of bundled window", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := setupArchives(t, archives[:2]...)
+
+		clk := clock{}
+		clk.Set(time.Date(2021, 1, 2, 0, 0, 0, 0, time.Local))
+		transformer := BundleTransformer{Parser: TimestampSequenceNamer{TimestampFormat: "2006-01-02T15-04"}, NowFunc: clk.Now}
+
+		err := transformer.Sweep(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+
+		NewFiles(t, dir, "content of application_2021-01-01T12-00.0.log", "application_2021-01-01T12-00.0.log")
+
+		err = transformer.Sweep(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application_2021-01-01-1.log.tar", "application_2021-01-01.log.tar"})
+	})
+
+	t.Run("window of given archive is not bundled", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := setupArchives(t, archives[:3]...)
+
+		// rotation at midnight, the archive is of the previous day
+		clk := clock{}
+		clk.Set(time.Date(2021, 1, 3, 0, 0, 1, 0, time.Local))
+		transformer := BundleTransformer{Parser: TimestampSequenceNamer{TimestampFormat: "2006-01-02T15-04"}, NowFunc: clk.Now}
+
+		path, err := transformer.Transform(filepath.Join(dir, archives[2]))
+		r.NoErr(err)                                   // should not be any error
+		r.Equal(path, filepath.Join(dir, archives[2])) // path should be unchanged
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application_2021-01-01.log.tar",
+			"application_2021-01-02T10-00.0.log",
+		}) // returned archive should still exist
+
+		err = transformer.Sweep(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application_2021-01-01.log.tar",
+			"application_2021-01-02.log.tar",
+		}) // window should be bundled by next sweep
+	})
+
+	t.Run("bundle retention", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := setupArchives(t, archives...)
+
+		clk := clock{}
+		clk.Set(time.Date(2021, 1, 3, 12, 0, 0, 0, time.Local))
+		transformer := BundleTransformer{
+			Parser:     TimestampSequenceNamer{TimestampFormat: "2006-01-02T15-04"},
+			MaxBundles: 1,
+			NowFunc:    clk.Now,
+		}
+
+		err := transformer.Sweep(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application_2021-01-02.log.tar",
+			"application_2021-01-03T10-00.0.log",
+		}) // oldest bundles beyond max should be removed
+
+		clk.Set(time.Date(2021, 1, 5, 12, 0, 0, 0, time.Local))
+		transformer.MaxBundles = 0
+		transformer.MaxBundleAge = 60 * time.Hour
+
+		err = transformer.Sweep(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application_2021-01-03.log.tar",
+		}) // bundles older than max age should be removed
+	})
+
+	t.Run("start sweep", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := setupArchives(t, archives[:1]...)
+
+		transformer := BundleTransformer{Parser: TimestampSequenceNamer{TimestampFormat: "2006-01-02T15-04"}}
+
+		stop := transformer.StartSweep(filepath.Join(dir, "application.log"), time.Millisecond)
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if _, err := os.Stat(filepath.Join(dir, "application_2021-01-01.log.tar")); err == nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		stop()
+		stop() // should be safe to stop again
+
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application_2021-01-01.log.tar"}) // archive should be bundled by sweep
+	})
+}
@@ -0,0 +1,273 @@
+package barrelfile
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// SHA256Ext is the extension of the sidecar file holding the SHA-256
+	// checksum of an archive, added to the name of the archive.
+	SHA256Ext = ".sha256"
+
+	// CRC32CExt is the extension of the sidecar file holding the CRC-32C
+	// checksum of an archive, added to the name of the archive.
+	CRC32CExt = ".crc32c"
+)
+
+// ChecksumTransformer records the checksum of the file, it is expected to be
+// used after the transformers generating the final archive.
+//
+// Checksums are recorded in the format of sha256sum(1), ie. one line of hex
+// encoded checksum, two spaces and name of the file for each file, so that
+// they can also be verified with `sha256sum -c`.
+type ChecksumTransformer struct {
+	// Manifest is the name of the manifest file, in the directory of the file,
+	// to which the checksum is appended, eg. SHA256SUMS. If unset, checksum is
+	// written to a sidecar file next to the file, with SHA256Ext added to its
+	// name.
+	Manifest string
+
+	// CRC32C additionally computes the CRC-32C checksum of the file, which is
+	// written to a sidecar file with CRC32CExt added to its name, or to the
+	// manifest with CRC32CExt added to its name.
+	CRC32C bool
+}
+
+var _ Transformer = (*ChecksumTransformer)(nil)
+
+// Transform computes the checksum of the file at the given path, and writes it
+// to the sidecar file or appends it to the Manifest. The given path is
+// returned unchanged.
+//
+// If there are any errors while computing or writing the checksum then non-nil
+// error is returned.
+func (t ChecksumTransformer) Transform(path string) (string, error) {
+	stat, err := os.Stat(path)
+	if err != nil && os.IsNotExist(err) {
+		return path, fmt.Errorf("no such file: %w", err)
+	}
+	if err != nil {
+		return path, fmt.Errorf("os stat: %w", err)
+	}
+	if stat.IsDir() {
+		return path, fmt.Errorf("path is of a directory not a file")
+	}
+	sha, crc, _, err := fileChecksums(path)
+	if err != nil {
+		return path, fmt.Errorf("compute checksums: %w", err)
+	}
+	if err := t.record(path, SHA256Ext, sha, stat.Mode().Perm()); err != nil {
+		return path, fmt.Errorf("record sha256: %w", err)
+	}
+	if t.CRC32C {
+		if err := t.record(path, CRC32CExt, crc, stat.Mode().Perm()); err != nil {
+			return path, fmt.Errorf("record crc32c: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// record writes checksum line for the file at path to its sidecar file with
+// the given extension, or appends it to the Manifest.
+func (t ChecksumTransformer) record(path, ext, sum string, perm os.FileMode) error {
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+	if len(t.Manifest) == 0 {
+		if err := ioutil.WriteFile(path+ext, []byte(line), perm); err != nil {
+			return fmt.Errorf("write sidecar: %w", err)
+		}
+		return nil
+	}
+	manifest := filepath.Join(filepath.Dir(path), t.Manifest)
+	if ext != SHA256Ext {
+		manifest += ext
+	}
+	// a single append of a line is atomic, so concurrent transformers do not
+	// interleave lines.
+	file, err := os.OpenFile(manifest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, perm)
+	if err != nil {
+		return fmt.Errorf("open manifest: %w", err)
+	}
+	if _, err := file.Write([]byte(line)); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("append manifest: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("sync manifest: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close manifest: %w", err)
+	}
+	return nil
+}
+
+// ChecksumFailure describes a file failing verification against a manifest.
+type ChecksumFailure struct {
+	// Path of the file.
+	Path string
+
+	// Err is the cause of failure. It wraps ErrChecksumMismatch when the
+	// checksum does not match.
+	Err error
+}
+
+// VerifyChecksum verifies the file at the given path against its sidecar
+// files, as written by ChecksumTransformer. Both SHA-256 and CRC-32C checksums
+// are verified, if present. A sidecar holding a single checksum is verified
+// whatever name it records, as the archive may have been renamed along with
+// its sidecar, eg. by ShiftingNamer.
+//
+// If the checksum does not match then error wrapping ErrChecksumMismatch is
+// returned. If there are no sidecar files or any other errors while verifying
+// then non-nil error is returned.
+func VerifyChecksum(path string) error {
+	verified := false
+	for _, ext := range []string{SHA256Ext, CRC32CExt} {
+		entries, err := readChecksums(path + ext)
+		if err != nil && os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read sidecar: %w", err)
+		}
+		sum, ok := entries.sums[filepath.Base(path)]
+		if len(entries.names) == 1 {
+			sum, ok = entries.sums[entries.names[0]], true
+		}
+		if !ok {
+			return fmt.Errorf("no checksum of %s in sidecar", filepath.Base(path))
+		}
+		if err := verifyFile(path, sum); err != nil {
+			return err
+		}
+		verified = true
+	}
+	if !verified {
+		return fmt.Errorf("no checksum sidecar")
+	}
+	return nil
+}
+
+// VerifyManifest verifies the files listed in the manifest file at the given
+// path against their checksums, as written by ChecksumTransformer. Files are
+// looked up in the directory of the manifest. If a file is listed multiple
+// times, then its last checksum is verified.
+//
+// Entries are never removed from the manifest, so archives removed
+// intentionally, eg. by RetentionTransformer or BundleTransformer, remain
+// listed. Hence the paths of missing files are returned separately from the
+// files failing verification, so that callers may ignore them. Both are
+// returned in the order of the manifest. If there are any errors while reading
+// the manifest then non-nil error is returned.
+func VerifyManifest(path string) (failures []ChecksumFailure, missing []string, err error) {
+	entries, err := readChecksums(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read manifest: %w", err)
+	}
+	for _, name := range entries.names {
+		filePath := filepath.Join(filepath.Dir(path), name)
+		err := verifyFile(filePath, entries.sums[name])
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			missing = append(missing, filePath)
+		case err != nil:
+			failures = append(failures, ChecksumFailure{Path: filePath, Err: err})
+		}
+	}
+	return failures, missing, nil
+}
+
+// checksums are the entries of a manifest or a sidecar file.
+type checksums struct {
+	// names of the files, in order of their first entry.
+	names []string
+
+	// sums of the files, by name.
+	sums map[string]string
+}
+
+// readChecksums reads the checksum lines of the file at the given path.
+func readChecksums(path string) (checksums, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return checksums{}, err
+	}
+	defer func() { _ = file.Close() }()
+
+	entries := checksums{sums: make(map[string]string)}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+		i := strings.IndexByte(text, ' ')
+		if i < 0 || i+2 > len(text) || (text[i+1] != ' ' && text[i+1] != '*') {
+			return checksums{}, fmt.Errorf("malformed line %d", line)
+		}
+		sum, name := strings.ToLower(text[:i]), text[i+2:]
+		if _, ok := entries.sums[name]; !ok {
+			entries.names = append(entries.names, name)
+		}
+		entries.sums[name] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return checksums{}, fmt.Errorf("scan: %w", err)
+	}
+	return entries, nil
+}
+
+// verifyFile verifies the file at the given path against the given hex encoded
+// checksum, whose algorithm is determined by its length.
+func verifyFile(path, sum string) error {
+	sha, crc, _, err := fileChecksums(path)
+	if err != nil {
+		return err
+	}
+	var actual string
+	switch len(sum) {
+	case len(sha):
+		actual = sha
+	case len(crc):
+		actual = crc
+	default:
+		return fmt.Errorf("unknown checksum %q", sum)
+	}
+	if actual != sum {
+		return fmt.Errorf("%s: %w", filepath.Base(path), ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// fileChecksums returns the hex encoded SHA-256 and CRC-32C checksums, and the
+// size of the file at the given path.
+func fileChecksums(path string) (string, string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("os open: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	sha := sha256.New()
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	size, err := io.Copy(io.MultiWriter(sha, crc), file)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("read file: %w", err)
+	}
+	return hexSum(sha), hexSum(crc), size, nil
+}
+
+func hexSum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
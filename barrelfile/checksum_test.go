@@ -0,0 +1,232 @@
+package barrelfile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestChecksumTransformer_Transform(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no file at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		// Hopefully this is random
+		randomPath := filepath.Join(dir, "g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn")
+
+		path, err := ChecksumTransformer{}.Transform(randomPath)
+		r.True(err != nil)         // should be non nil
+		r.True(path == randomPath) // path returned should be same as given path
+	})
+
+	t.Run("directory at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		path, err := ChecksumTransformer{}.Transform(dir)
+		r.True(err != nil)  // should be non nil
+		r.True(path == dir) // path returned should be same as given path
+	})
+
+	t.Run("sidecar", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "hello world\n", "application.log.1")
+		file := filepath.Join(dir, "application.log.1")
+
+		path, err := ChecksumTransformer{CRC32C: true}.Transform(file)
+		r.NoErr(err)        // should not be any error
+		r.Equal(path, file) // path should be unchanged
+		r.Equal(DirFiles(t, dir), []string{"application.log.1", "application.log.1.crc32c", "application.log.1.sha256"})
+
+		sha, err := ioutil.ReadFile(file + SHA256Ext)
+		r.NoErr(err) // should not be any error
+		r.Equal(string(sha), "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447  application.log.1\n")
+
+		crc, err := ioutil.ReadFile(file + CRC32CExt)
+		r.NoErr(err) // should not be any error
+		r.Equal(string(crc), "f0ff7292  application.log.1\n")
+
+		err = VerifyChecksum(file)
+		r.NoErr(err) // should not be any error
+
+		if _, err := exec.LookPath("sha256sum"); err == nil {
+			cmd := exec.Command("sha256sum", "-c", "application.log.1.sha256")
+			cmd.Dir = dir
+			out, err := cmd.CombinedOutput()
+			r.NoErr(err) // sidecar should be verifiable by sha256sum
+			r.True(strings.Contains(string(out), "OK"))
+		}
+	})
+
+	t.Run("manifest", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "archive", "application.log.1", "application.log.2")
+
+		transformer := ChecksumTransformer{Manifest: "SHA256SUMS", CRC32C: true}
+		for _, name := range []string{"application.log.2", "application.log.1"} {
+			_, err := transformer.Transform(filepath.Join(dir, name))
+			r.NoErr(err) // should not be any error
+		}
+		r.Equal(DirFiles(t, dir), []string{"SHA256SUMS", "SHA256SUMS.crc32c", "application.log.1", "application.log.2"})
+
+		manifest, err := ioutil.ReadFile(filepath.Join(dir, "SHA256SUMS"))
+		r.NoErr(err)                                                         // should not be any error
+		r.Equal(strings.Count(string(manifest), "\n"), 2)                    // manifest should have a line per file
+		r.True(strings.HasSuffix(string(manifest), "  application.log.1\n")) // checksums should be appended
+
+		for _, name := range []string{"SHA256SUMS", "SHA256SUMS.crc32c"} {
+			failures, missing, err := VerifyManifest(filepath.Join(dir, name))
+			r.NoErr(err)              // should not be any error
+			r.Equal(len(failures), 0) // all files should be verified
+			r.Equal(len(missing), 0)  // no files should be missing
+		}
+	})
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no sidecar", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		file := NewFile(t, dir, "checksum-*")
+
+		err := VerifyChecksum(file)
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("modified file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log.1")
+		file := filepath.Join(dir, "application.log.1")
+
+		_, err := ChecksumTransformer{}.Transform(file)
+		r.NoErr(err) // should not be any error
+
+		err = os.Truncate(file, 10)
+		r.NoErr(err) // should not be any error
+
+		err = VerifyChecksum(file)
+		r.True(errors.Is(err, ErrChecksumMismatch)) // error should wrap ErrChecksumMismatch
+	})
+
+	t.Run("renamed file with sidecar", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log.1")
+
+		_, err := ChecksumTransformer{CRC32C: true}.Transform(filepath.Join(dir, "application.log.1"))
+		r.NoErr(err) // should not be any error
+
+		// shift of the archive, along with its sidecars
+		_, err = ShiftingNamer{}.Name(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log.2", "application.log.2.crc32c", "application.log.2.sha256"})
+
+		err = VerifyChecksum(filepath.Join(dir, "application.log.2"))
+		r.NoErr(err) // renamed file should be verified
+	})
+
+	t.Run("modified file with only crc32c", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log.1")
+		file := filepath.Join(dir, "application.log.1")
+
+		_, err := ChecksumTransformer{CRC32C: true}.Transform(file)
+		r.NoErr(err) // should not be any error
+		err = os.Remove(file + SHA256Ext)
+		r.NoErr(err) // should not be any error
+
+		err = ioutil.WriteFile(file, []byte(strings.ToUpper(testText)), 0644)
+		r.NoErr(err) // should not be any error
+
+		err = VerifyChecksum(file)
+		r.True(errors.Is(err, ErrChecksumMismatch)) // error should wrap ErrChecksumMismatch
+	})
+}
+
+func TestVerifyManifest(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no manifest", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		_, _, err := VerifyManifest(filepath.Join(dir, "SHA256SUMS"))
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("malformed manifest", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "not a manifest", "SHA256SUMS")
+
+		_, _, err := VerifyManifest(filepath.Join(dir, "SHA256SUMS"))
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("modified and missing files", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "archive", "application.log.1", "application.log.2", "application.log.3")
+
+		transformer := ChecksumTransformer{Manifest: "SHA256SUMS"}
+		for _, name := range []string{"application.log.3", "application.log.2", "application.log.1"} {
+			_, err := transformer.Transform(filepath.Join(dir, name))
+			r.NoErr(err) // should not be any error
+		}
+
+		err := ioutil.WriteFile(filepath.Join(dir, "application.log.2"), []byte("modified"), 0644)
+		r.NoErr(err) // should not be any error
+		err = os.Remove(filepath.Join(dir, "application.log.3"))
+		r.NoErr(err) // should not be any error
+
+		failures, missing, err := VerifyManifest(filepath.Join(dir, "SHA256SUMS"))
+		r.NoErr(err)              // should not be any error
+		r.Equal(len(failures), 1) // modified file should fail
+		r.Equal(failures[0].Path, filepath.Join(dir, "application.log.2"))
+		r.True(errors.Is(failures[0].Err, ErrChecksumMismatch))             // modified file error should wrap ErrChecksumMismatch
+		r.Equal(missing, []string{filepath.Join(dir, "application.log.3")}) // missing file should be reported separately
+	})
+}
@@ -0,0 +1,316 @@
+package barrelfile
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Codec compresses and decompresses streams in a particular format.
+type Codec interface {
+	// Name of the codec, used to look up the codec, eg. gzip.
+	Name() string
+
+	// Ext is the file extension of the format, eg. .gz.
+	Ext() string
+
+	// NewWriter returns a writer compressing the bytes written to it into w.
+	// The stream is finalized when the writer is closed.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+
+	// NewReader returns a reader decompressing the bytes read from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// NoCompressionLevel selects no compression for GzipCodec, ZlibCodec and
+// DeflateCodec, as their unset level selects the default compression.
+const NoCompressionLevel = -100
+
+// flateLevel converts the level of the codecs to the level of compress/flate.
+func flateLevel(level int) int {
+	switch level {
+	case 0:
+		return flate.DefaultCompression
+	case NoCompressionLevel:
+		return flate.NoCompression
+	}
+	return level
+}
+
+// GzipCodec is a Codec for gzip format, backed by compress/gzip.
+type GzipCodec struct {
+	// Level of compression. If unset (ie. 0), it will correspond to
+	// gzip.DefaultCompression.
+	Level int
+}
+
+var _ Codec = (*GzipCodec)(nil)
+
+// Name returns "gzip".
+func (c GzipCodec) Name() string { return "gzip" }
+
+// Ext returns ".gz".
+func (c GzipCodec) Ext() string { return ".gz" }
+
+// NewWriter returns a gzip writer.
+func (c GzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	gzw, err := gzip.NewWriterLevel(w, flateLevel(c.Level))
+	if err != nil {
+		return nil, fmt.Errorf("gzip new writer level: %w", err)
+	}
+	return gzw, nil
+}
+
+// NewReader returns a gzip reader.
+func (c GzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("gzip new reader: %w", err)
+	}
+	return gzr, nil
+}
+
+// ZlibCodec is a Codec for zlib format, backed by compress/zlib.
+type ZlibCodec struct {
+	// Level of compression. If unset (ie. 0), it will correspond to
+	// zlib.DefaultCompression.
+	Level int
+}
+
+var _ Codec = (*ZlibCodec)(nil)
+
+// Name returns "zlib".
+func (c ZlibCodec) Name() string { return "zlib" }
+
+// Ext returns ".zz".
+func (c ZlibCodec) Ext() string { return ".zz" }
+
+// NewWriter returns a zlib writer.
+func (c ZlibCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	zw, err := zlib.NewWriterLevel(w, flateLevel(c.Level))
+	if err != nil {
+		return nil, fmt.Errorf("zlib new writer level: %w", err)
+	}
+	return zw, nil
+}
+
+// NewReader returns a zlib reader.
+func (c ZlibCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("zlib new reader: %w", err)
+	}
+	return zr, nil
+}
+
+// DeflateCodec is a Codec for raw deflate format, backed by compress/flate.
+type DeflateCodec struct {
+	// Level of compression. If unset (ie. 0), it will correspond to
+	// flate.DefaultCompression.
+	Level int
+}
+
+var _ Codec = (*DeflateCodec)(nil)
+
+// Name returns "deflate".
+func (c DeflateCodec) Name() string { return "deflate" }
+
+// Ext returns ".deflate".
+func (c DeflateCodec) Ext() string { return ".deflate" }
+
+// NewWriter returns a flate writer.
+func (c DeflateCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	fw, err := flate.NewWriter(w, flateLevel(c.Level))
+	if err != nil {
+		return nil, fmt.Errorf("flate new writer: %w", err)
+	}
+	return fw, nil
+}
+
+// NewReader returns a flate reader.
+func (c DeflateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+// ExecCodec is a Codec backed by an external program, such as xz or zstd,
+// which compresses its stdin to its stdout.
+type ExecCodec struct {
+	// CodecName is the name of the codec.
+	CodecName string
+
+	// Extension is the file extension of the format.
+	Extension string
+
+	// Compress is the command, and its arguments, compressing stdin to
+	// stdout, eg. ["xz", "-c"].
+	Compress []string
+
+	// Decompress is the command, and its arguments, decompressing stdin to
+	// stdout, eg. ["xz", "-dc"].
+	Decompress []string
+}
+
+var _ Codec = (*ExecCodec)(nil)
+
+// Name returns the CodecName.
+func (c ExecCodec) Name() string { return c.CodecName }
+
+// Ext returns the Extension.
+func (c ExecCodec) Ext() string { return c.Extension }
+
+// NewWriter starts the Compress command writing to w. The command is waited
+// for when the returned writer is closed.
+func (c ExecCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if len(c.Compress) == 0 {
+		return nil, fmt.Errorf("no compress command")
+	}
+	cmd := exec.Command(c.Compress[0], c.Compress[1:]...)
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdin pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", c.Compress[0], err)
+	}
+	return &execWriter{WriteCloser: stdin, cmd: cmd, stderr: &stderr}, nil
+}
+
+// NewReader starts the Decompress command reading from r. The command is
+// waited for when the returned reader is closed.
+func (c ExecCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	if len(c.Decompress) == 0 {
+		return nil, fmt.Errorf("no decompress command")
+	}
+	cmd := exec.Command(c.Decompress[0], c.Decompress[1:]...)
+	cmd.Stdin = r
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", c.Decompress[0], err)
+	}
+	return &execReader{ReadCloser: stdout, cmd: cmd, stderr: &stderr}, nil
+}
+
+type execWriter struct {
+	io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (w *execWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		_ = w.cmd.Wait()
+		return fmt.Errorf("close stdin: %w", err)
+	}
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("wait: %w: %s", err, strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+type execReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (r *execReader) Close() error {
+	if _, err := io.Copy(ioutil.Discard, r.ReadCloser); err != nil {
+		_ = r.cmd.Wait()
+		return fmt.Errorf("drain stdout: %w", err)
+	}
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("wait: %w: %s", err, strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]Codec)
+)
+
+func init() {
+	for _, codec := range []Codec{
+		GzipCodec{},
+		ZlibCodec{},
+		DeflateCodec{},
+		ExecCodec{CodecName: "xz", Extension: ".xz", Compress: []string{"xz", "-c"}, Decompress: []string{"xz", "-dc"}},
+		ExecCodec{CodecName: "zstd", Extension: ".zst", Compress: []string{"zstd", "-q", "-c"}, Decompress: []string{"zstd", "-q", "-dc"}},
+	} {
+		codecs[codec.Name()] = codec
+	}
+}
+
+// RegisterCodec makes the codec available by its name with LookupCodec,
+// replacing any codec registered with the same name. Extension of the codec
+// is recognized as suffix of archives by parsers.
+//
+// If the codec is nil or has no extension, as the compressed file would then
+// replace the original file, then non-nil error is returned.
+func RegisterCodec(codec Codec) error {
+	if codec == nil {
+		return fmt.Errorf("no codec")
+	}
+	if len(codec.Ext()) == 0 {
+		return fmt.Errorf("codec %q has no extension", codec.Name())
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Name()] = codec
+	return nil
+}
+
+// LookupCodec returns the codec registered with the given name. By default
+// gzip, zlib, deflate, xz and zstd are registered, where xz and zstd require
+// the corresponding programs to be installed.
+//
+// If there is no codec registered with given name then non-nil error is
+// returned.
+func LookupCodec(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return codec, nil
+}
+
+// Codecs returns the names of the registered codecs, sorted.
+func Codecs() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	var names []string
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// codecExts returns the extensions of the registered codecs.
+func codecExts() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	var exts []string
+	for _, codec := range codecs {
+		exts = append(exts, codec.Ext())
+	}
+	return exts
+}
@@ -0,0 +1,163 @@
+package barrelfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, codec := range []Codec{
+		GzipCodec{},
+		GzipCodec{Level: NoCompressionLevel},
+		GzipCodec{Level: 9},
+		ZlibCodec{},
+		ZlibCodec{Level: NoCompressionLevel},
+		DeflateCodec{},
+		DeflateCodec{Level: 1},
+		ExecCodec{CodecName: "xz", Extension: ".xz", Compress: []string{"xz", "-c"}, Decompress: []string{"xz", "-dc"}},
+		ExecCodec{CodecName: "zstd", Extension: ".zst", Compress: []string{"zstd", "-q", "-c"}, Decompress: []string{"zstd", "-q", "-dc"}},
+	} {
+		codec := codec
+		t.Run(codec.Name(), func(t *testing.T) {
+			t.Parallel()
+			r := is.New(t)
+
+			if ec, ok := codec.(ExecCodec); ok {
+				if _, err := exec.LookPath(ec.Compress[0]); err != nil {
+					t.Skipf("%s not installed", ec.Compress[0])
+				}
+			}
+
+			var compressed bytes.Buffer
+			w, err := codec.NewWriter(&compressed)
+			r.NoErr(err) // should not be any error
+			_, err = w.Write([]byte(testText))
+			r.NoErr(err) // should not be any error
+			err = w.Close()
+			r.NoErr(err) // should not be any error
+
+			rd, err := codec.NewReader(&compressed)
+			r.NoErr(err) // should not be any error
+			content, err := ioutil.ReadAll(rd)
+			r.NoErr(err) // should not be any error
+			err = rd.Close()
+			r.NoErr(err)                       // should not be any error
+			r.Equal(string(content), testText) // decompressed content should be same as original
+		})
+	}
+}
+
+func TestGzipCodec_Level(t *testing.T) {
+	t.Parallel()
+	r := is.New(t)
+
+	compress := func(codec Codec) int {
+		var buf bytes.Buffer
+		w, err := codec.NewWriter(&buf)
+		r.NoErr(err) // should not be any error
+		_, err = w.Write([]byte(strings.Repeat(testText, 10)))
+		r.NoErr(err) // should not be any error
+		err = w.Close()
+		r.NoErr(err) // should not be any error
+		return buf.Len()
+	}
+
+	r.True(compress(GzipCodec{}) < len(testText))                             // unset level should compress
+	r.True(compress(GzipCodec{Level: NoCompressionLevel}) > 10*len(testText)) // no compression level should not compress
+}
+
+func TestExecCodec(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no command", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		codec := ExecCodec{CodecName: "none", Extension: ".none"}
+
+		_, err := codec.NewWriter(&bytes.Buffer{})
+		r.True(err != nil) // should be non nil
+
+		_, err = codec.NewReader(&bytes.Buffer{})
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("failing command", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		if _, err := exec.LookPath("sh"); err != nil {
+			t.Skip("sh not installed")
+		}
+
+		codec := ExecCodec{CodecName: "fail", Extension: ".fail", Compress: []string{"sh", "-c", "cat > /dev/null; echo broken >&2; exit 3"}}
+
+		w, err := codec.NewWriter(&bytes.Buffer{})
+		r.NoErr(err) // should not be any error
+		_, err = w.Write([]byte(testText))
+		r.NoErr(err) // should not be any error
+		err = w.Close()
+		r.True(err != nil)                              // should be non nil
+		r.True(strings.Contains(err.Error(), "broken")) // error should contain stderr of command
+	})
+}
+
+func TestLookupCodec(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default codecs", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		for name, ext := range map[string]string{"gzip": ".gz", "zlib": ".zz", "deflate": ".deflate", "xz": ".xz", "zstd": ".zst"} {
+			codec, err := LookupCodec(name)
+			r.NoErr(err)              // should not be any error
+			r.Equal(codec.Ext(), ext) // codec should have expected extension
+		}
+	})
+
+	t.Run("unknown codec", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, err := LookupCodec("g3t4c5x15nx3k0fs3125nl400000gn")
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("registered codec", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		err := RegisterCodec(ExecCodec{CodecName: "test-registered", Extension: ".testreg"})
+		r.NoErr(err) // should not be any error
+
+		codec, err := LookupCodec("test-registered")
+		r.NoErr(err) // should not be any error
+		r.Equal(codec.Ext(), ".testreg")
+
+		ext, suffix := splitSuffix(".log.testreg")
+		r.Equal(ext, ".log")        // registered codec extension should not be part of extension
+		r.Equal(suffix, ".testreg") // registered codec extension should be recognized as suffix
+	})
+
+	t.Run("codec without extension", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		err := RegisterCodec(ExecCodec{CodecName: "test-no-extension"})
+		r.True(err != nil) // should be non nil
+
+		_, err = LookupCodec("test-no-extension")
+		r.True(err != nil) // codec should not be registered
+
+		err = RegisterCodec(nil)
+		r.True(err != nil) // should be non nil
+	})
+}
@@ -0,0 +1,156 @@
+package barrelfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CommandTransformer executes an external command for the file, like the
+// postrotate scripts of logrotate, eg. to ship or index the archive. It is
+// expected to be used after the transformers generating the final archive.
+//
+// The path of the file is appended as the last argument of the command, and
+// the metadata of the rotation is passed in the environment variables:
+//
+//	BARREL_PATH       path of the file
+//	BARREL_NAME       name of the file
+//	BARREL_DIR        directory of the file
+//	BARREL_SIZE       size of the file in bytes
+//	BARREL_TIME       time of the rotation, in RFC 3339 format
+//
+// and if the file is parsed as an archive by the Parser:
+//
+//	BARREL_ORIGINAL   name of the original file of the archive
+//	BARREL_TIMESTAMP  timestamp of the archive, in RFC 3339 format, if any
+//	BARREL_SEQUENCE   sequence of the archive
+type CommandTransformer struct {
+	// Command, and its arguments, executed for the file, eg.
+	// ["/usr/local/bin/ship-logs", "--bucket", "logs"].
+	Command []string
+
+	// Env is the additional environment of the command, in the form
+	// "key=value". The environment of the process is always inherited.
+	Env []string
+
+	// Dir is the working directory of the command. If unset, the working
+	// directory of the process is used.
+	Dir string
+
+	// Parser used to parse the metadata of the archive. If unset, archive
+	// metadata is not passed to the command.
+	Parser Parser
+
+	// Timeout after which the command is killed, and the transform fails. If
+	// unset (ie. 0), the command is never killed. Note that child processes of
+	// the command are not killed, so the command should exec long running
+	// processes, as the transform waits for them to close stderr.
+	Timeout time.Duration
+
+	// WarnOnFailure logs non-zero exit status of the command to the Logger,
+	// instead of failing the transform. Failures to start the command and
+	// timeouts always fail the transform.
+	WarnOnFailure bool
+
+	// NowFunc to wrap stdlib time.Now for testing.
+	NowFunc func() time.Time
+
+	// Logger logs the warnings of failed commands. If unset, nothing is
+	// logged.
+	Logger *log.Logger
+}
+
+var _ Transformer = (*CommandTransformer)(nil)
+
+// Transform executes the Command for the file at the given path, and waits for
+// it to exit. The given path is returned unchanged.
+//
+// If the command cannot be started, times out or exits with non-zero status,
+// unless WarnOnFailure, then non-nil error including the stderr of the command
+// is returned.
+func (t CommandTransformer) Transform(path string) (string, error) {
+	if len(t.Command) == 0 {
+		return path, fmt.Errorf("no command")
+	}
+	stat, err := os.Stat(path)
+	if err != nil && os.IsNotExist(err) {
+		return path, fmt.Errorf("no such file: %w", err)
+	}
+	if err != nil {
+		return path, fmt.Errorf("os stat: %w", err)
+	}
+	if stat.IsDir() {
+		return path, fmt.Errorf("path is of a directory not a file")
+	}
+
+	ctx := context.Background()
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	args := append(append([]string(nil), t.Command[1:]...), path)
+	cmd := exec.CommandContext(ctx, t.Command[0], args...)
+	cmd.Dir = t.Dir
+	cmd.Env = append(append(os.Environ(), t.env(path, stat.Size())...), t.Env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return path, fmt.Errorf("start %s: %w", t.Command[0], err)
+	}
+	err = cmd.Wait()
+	if ctx.Err() == context.DeadlineExceeded {
+		return path, fmt.Errorf("%s timed out after %s: %w: %s", t.Command[0], t.Timeout, ctx.Err(), strings.TrimSpace(stderr.String()))
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && t.WarnOnFailure {
+		logf(t.Logger, "command: %s %s: %v: %s", t.Command[0], path, err, strings.TrimSpace(stderr.String()))
+		return path, nil
+	}
+	if err != nil {
+		return path, fmt.Errorf("%s: %w: %s", t.Command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return path, nil
+}
+
+// env returns the environment variables of the metadata of the file at the
+// given path.
+func (t CommandTransformer) env(path string, size int64) []string {
+	var nowTime time.Time
+	if t.NowFunc != nil {
+		nowTime = t.NowFunc()
+	} else {
+		nowTime = time.Now()
+	}
+	env := []string{
+		"BARREL_PATH=" + path,
+		"BARREL_NAME=" + filepath.Base(path),
+		"BARREL_DIR=" + filepath.Dir(path),
+		"BARREL_SIZE=" + strconv.FormatInt(size, 10),
+		"BARREL_TIME=" + nowTime.Format(time.RFC3339),
+	}
+	if t.Parser == nil {
+		return env
+	}
+	archive, err := t.Parser.Parse(path)
+	if err != nil {
+		return env
+	}
+	env = append(env,
+		"BARREL_ORIGINAL="+archive.Name(),
+		"BARREL_SEQUENCE="+strconv.Itoa(archive.Sequence),
+	)
+	if !archive.Timestamp.IsZero() {
+		env = append(env, "BARREL_TIMESTAMP="+archive.Timestamp.Format(time.RFC3339))
+	}
+	return env
+}
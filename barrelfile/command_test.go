@@ -0,0 +1,156 @@
+package barrelfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestCommandTransformer_Transform(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no command", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log.1")
+		file := filepath.Join(dir, "application.log.1")
+
+		path, err := CommandTransformer{}.Transform(file)
+		r.True(err != nil)  // should be non nil
+		r.Equal(path, file) // path returned should be same as given path
+	})
+
+	t.Run("no file at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		// Hopefully this is random
+		randomPath := filepath.Join(dir, "g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn")
+
+		path, err := CommandTransformer{Command: []string{"true"}}.Transform(randomPath)
+		r.True(err != nil)         // should be non nil
+		r.True(path == randomPath) // path returned should be same as given path
+	})
+
+	t.Run("arguments and environment", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application_2021-01-01.3.log")
+		file := filepath.Join(dir, "application_2021-01-01.3.log")
+		out := filepath.Join(dir, "out")
+
+		transformer := CommandTransformer{
+			Command: []string{"sh", "-c", `{ echo "$1"; env | grep '^BARREL_' | sort; } > "$OUT"`, "sh"},
+			Env:     []string{"OUT=" + out},
+			Parser:  TimestampSequenceNamer{},
+			NowFunc: (&clock{time: testTime}).Now,
+		}
+		path, err := transformer.Transform(file)
+		r.NoErr(err)        // should not be any error
+		r.Equal(path, file) // path should be unchanged
+
+		data, err := ioutil.ReadFile(out)
+		r.NoErr(err) // should not be any error
+		r.Equal(strings.Split(strings.TrimSpace(string(data)), "\n"), []string{
+			file,
+			"BARREL_DIR=" + dir,
+			"BARREL_NAME=application_2021-01-01.3.log",
+			"BARREL_ORIGINAL=application.log",
+			"BARREL_PATH=" + file,
+			"BARREL_SEQUENCE=3",
+			"BARREL_SIZE=" + strconv.Itoa(len(testText)),
+			"BARREL_TIME=2021-01-01T06:15:00Z",
+			"BARREL_TIMESTAMP=2021-01-01T00:00:00Z",
+		}) // command should get path as last argument, and metadata in environment
+		r.NoErr(os.Remove(out)) // should not be any error
+	})
+
+	t.Run("non zero exit", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log.1")
+		file := filepath.Join(dir, "application.log.1")
+
+		path, err := CommandTransformer{Command: []string{"sh", "-c", "echo shipping failed >&2; exit 3"}}.Transform(file)
+		r.True(err != nil)                                       // should be non nil
+		r.True(strings.Contains(err.Error(), "exit status 3"))   // error should have exit status
+		r.True(strings.Contains(err.Error(), "shipping failed")) // error should have stderr
+		r.Equal(path, file)                                      // path returned should be same as given path
+	})
+
+	t.Run("non zero exit as warning", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log.1")
+		file := filepath.Join(dir, "application.log.1")
+
+		var logs bytes.Buffer
+		transformer := CommandTransformer{
+			Command:       []string{"sh", "-c", "echo shipping failed >&2; exit 3"},
+			WarnOnFailure: true,
+			Logger:        log.New(&logs, "", 0),
+		}
+		path, err := transformer.Transform(file)
+		r.NoErr(err)                                               // should not be any error
+		r.Equal(path, file)                                        // path should be unchanged
+		r.True(strings.Contains(logs.String(), "shipping failed")) // failure should be logged
+	})
+
+	t.Run("command not found", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log.1")
+		file := filepath.Join(dir, "application.log.1")
+
+		_, err := CommandTransformer{
+			Command:       []string{"g3t4c5x15nx3k0fs3125nl400000gn"},
+			WarnOnFailure: true,
+		}.Transform(file)
+		r.True(err != nil) // should be non nil even if failures are warnings
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log.1")
+		file := filepath.Join(dir, "application.log.1")
+
+		start := time.Now()
+		_, err := CommandTransformer{
+			Command:       []string{"sh", "-c", "exec sleep 10"},
+			Timeout:       50 * time.Millisecond,
+			WarnOnFailure: true,
+		}.Transform(file)
+		r.True(err != nil)                                 // should be non nil
+		r.True(strings.Contains(err.Error(), "timed out")) // error should report timeout
+		r.True(time.Since(start) < 5*time.Second)          // command should be killed
+	})
+}
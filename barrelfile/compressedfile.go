@@ -0,0 +1,251 @@
+package barrelfile
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CompressedFile is an io.WriteCloser which compresses the bytes written to it
+// on the fly, into the underlying os.File, using a Codec.
+//
+// The compressed stream is finalized only when the CompressedFile is closed.
+// To keep the partially written file readable after a crash, the compressor is
+// flushed every FlushBytes bytes or FlushInterval, which is supported by
+// GzipCodec, ZlibCodec and DeflateCodec.
+//
+// CompressedFile is accepted by TriggerAdapter and RotatorAdapter in place of
+// os.File. It is not safe for concurrent use, which barrel.RollingWriter
+// already guarantees.
+type CompressedFile struct {
+	// FlushBytes is the number of uncompressed bytes written after which the
+	// compressor is flushed. If unset (ie. 0), it is not flushed by bytes.
+	FlushBytes int64
+
+	// FlushInterval after which the compressor is flushed, checked on every
+	// write. If unset (ie. 0), it is not flushed by time.
+	FlushInterval time.Duration
+
+	// NowFunc to wrap stdlib time.Now for testing.
+	NowFunc func() time.Time
+
+	file  *os.File
+	codec Codec
+	cw    io.WriteCloser
+
+	size      int64
+	unflushed int64
+	flushedAt time.Time
+}
+
+// NewCompressedFile returns a CompressedFile compressing into the given file
+// using the given Codec, and appending to its current content.
+//
+// If the file is not empty, its content is decompressed to determine its
+// uncompressed size, and the new stream is appended after it. So it should
+// only be used with non-empty files for formats where concatenated streams are
+// valid, like gzip, xz or zstd.
+//
+// If the stream in the file is not finalized, eg. the process crashed before
+// closing the CompressedFile, nothing appended after it would be readable. So
+// the content readable up to the last flush is compressed again into a
+// finalized stream, replacing the content of the file, and the rest is lost.
+func NewCompressedFile(file *os.File, codec Codec) (*CompressedFile, error) {
+	if codec == nil {
+		return nil, fmt.Errorf("no codec")
+	}
+	size, err := recoverCompressed(file, codec)
+	if err != nil {
+		return nil, fmt.Errorf("recover compressed stream: %w", err)
+	}
+	cw, err := codec.NewWriter(file)
+	if err != nil {
+		return nil, fmt.Errorf("new compress writer: %w", err)
+	}
+	return &CompressedFile{file: file, codec: codec, cw: cw, size: size}, nil
+}
+
+// Name returns the name of the underlying file.
+func (f *CompressedFile) Name() string {
+	return f.file.Name()
+}
+
+// File returns the underlying file.
+func (f *CompressedFile) File() *os.File {
+	return f.file
+}
+
+// Codec returns the Codec compressing the file.
+func (f *CompressedFile) Codec() Codec {
+	return f.codec
+}
+
+// Size returns the uncompressed size of the file, ie. number of bytes written
+// to the file, including its content when it was opened.
+func (f *CompressedFile) Size() int64 {
+	return f.size
+}
+
+// Write compresses p into the file, and flushes the compressor if FlushBytes
+// or FlushInterval has been exceeded.
+func (f *CompressedFile) Write(p []byte) (int, error) {
+	n, err := f.cw.Write(p)
+	f.size += int64(n)
+	f.unflushed += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("compress: %w", err)
+	}
+	if f.flushDue() {
+		if err := f.Flush(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Flush flushes the compressor, so that everything written so far can be
+// decompressed from the file. It is a no-op for codecs not supporting flush.
+func (f *CompressedFile) Flush() error {
+	f.unflushed = 0
+	f.flushedAt = f.now()
+	flusher, ok := f.cw.(interface{ Flush() error })
+	if !ok {
+		return nil
+	}
+	if err := flusher.Flush(); err != nil {
+		return fmt.Errorf("flush compressor: %w", err)
+	}
+	return nil
+}
+
+// Sync flushes the compressor, and commits the file to stable storage.
+func (f *CompressedFile) Sync() error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("sync file: %w", err)
+	}
+	return nil
+}
+
+// Close finalizes the compressed stream, commits the file to stable storage,
+// and closes the file.
+func (f *CompressedFile) Close() error {
+	if err := f.cw.Close(); err != nil {
+		_ = f.file.Close()
+		return fmt.Errorf("close compress writer: %w", err)
+	}
+	if err := f.file.Sync(); err != nil {
+		_ = f.file.Close()
+		return fmt.Errorf("sync file: %w", err)
+	}
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+	return nil
+}
+
+func (f *CompressedFile) flushDue() bool {
+	if f.FlushBytes > 0 && f.unflushed >= f.FlushBytes {
+		return true
+	}
+	if f.FlushInterval > 0 {
+		if f.flushedAt.IsZero() {
+			f.flushedAt = f.now()
+		}
+		return f.unflushed > 0 && f.now().Sub(f.flushedAt) >= f.FlushInterval
+	}
+	return false
+}
+
+func (f *CompressedFile) now() time.Time {
+	if f.NowFunc != nil {
+		return f.NowFunc()
+	}
+	return time.Now()
+}
+
+// recoverCompressed returns the uncompressed size of the content of the given
+// file. If the stream is not finalized, the content readable from it is
+// compressed again into a finalized stream, replacing the content of the file.
+func recoverCompressed(file *os.File, codec Codec) (int64, error) {
+	path := file.Name()
+	size, complete, err := decompress(path, codec, ioutil.Discard)
+	if err != nil || complete {
+		return size, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	size, _, err = decompress(path, codec, tmp)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek temp file: %w", err)
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return 0, fmt.Errorf("truncate file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek file: %w", err)
+	}
+	cw, err := codec.NewWriter(file)
+	if err != nil {
+		return 0, fmt.Errorf("new compress writer: %w", err)
+	}
+	if _, err := io.Copy(cw, tmp); err != nil {
+		_ = cw.Close()
+		return 0, fmt.Errorf("copy and compress: %w", err)
+	}
+	if err := cw.Close(); err != nil {
+		return 0, fmt.Errorf("close compress writer: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("sync file: %w", err)
+	}
+	return size, nil
+}
+
+// decompressFile writes the decompressed content of the file at the given path
+// to w, and returns its size. A truncated stream, eg. one still being written,
+// is decompressed up to where it is readable.
+func decompressFile(path string, codec Codec, w io.Writer) (int64, error) {
+	n, _, err := decompress(path, codec, w)
+	return n, err
+}
+
+// decompress is decompressFile, which also tells whether the stream is
+// complete, ie. decompressed without any errors.
+func decompress(path string, codec Codec, w io.Writer) (n int64, complete bool, err error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, false, fmt.Errorf("os stat: %w", err)
+	}
+	if stat.Size() == 0 {
+		return 0, true, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false, fmt.Errorf("os open: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	cr, err := codec.NewReader(file)
+	if err != nil {
+		return 0, false, fmt.Errorf("new decompress reader: %w", err)
+	}
+	n, cerr := io.Copy(w, cr)
+	_ = cr.Close()
+	return n, cerr == nil, nil
+}
@@ -0,0 +1,172 @@
+package barrelfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestCompressedFile(t *testing.T) {
+	t.Parallel()
+
+	// openCompressedFile opens the file application.log.gz in a new directory,
+	// and wraps it in a CompressedFile with the given codec.
+	openCompressedFile := func(t *testing.T, codec Codec) *CompressedFile {
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+
+		file, err := os.OpenFile(filepath.Join(dir, "application.log.gz"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		r.NoErr(err) // should not be any error
+		cf, err := NewCompressedFile(file, codec)
+		r.NoErr(err) // should not be any error
+		return cf
+	}
+
+	// readGzip decompresses the gzip file at the given path, tolerating a
+	// stream which is not finalized.
+	readGzip := func(t *testing.T, path string) string {
+		r := is.New(t)
+
+		data, err := ioutil.ReadFile(path)
+		r.NoErr(err) // should not be any error
+		gzr, err := gzip.NewReader(bytes.NewReader(data))
+		r.NoErr(err) // should not be any error
+		content, err := ioutil.ReadAll(gzr)
+		if err != io.ErrUnexpectedEOF {
+			r.NoErr(err) // should not be any error
+		}
+		return string(content)
+	}
+
+	t.Run("no codec", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, err := NewCompressedFile(os.Stdout, nil)
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("close finalizes stream", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		cf := openCompressedFile(t, GzipCodec{})
+
+		n, err := cf.Write([]byte(testText))
+		r.NoErr(err)                             // should not be any error
+		r.Equal(n, len(testText))                // all bytes should be written
+		r.Equal(cf.Size(), int64(len(testText))) // uncompressed size should be tracked
+
+		err = cf.Close()
+		r.NoErr(err) // should not be any error
+
+		r.Equal(readGzip(t, cf.Name()), testText) // decompressed content should be same as written
+	})
+
+	t.Run("flush bytes makes partial file readable", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		cf := openCompressedFile(t, GzipCodec{})
+		cf.FlushBytes = 10
+		t.Cleanup(func() { _ = cf.Close() })
+
+		_, err := cf.Write([]byte("hello world\n"))
+		r.NoErr(err) // should not be any error
+
+		r.Equal(readGzip(t, cf.Name()), "hello world\n") // flushed bytes should be readable before close
+	})
+
+	t.Run("flush interval makes partial file readable", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		clk := clock{}
+		clk.Set(testTime)
+
+		cf := openCompressedFile(t, GzipCodec{})
+		cf.FlushInterval = time.Minute
+		cf.NowFunc = clk.Now
+		t.Cleanup(func() { _ = cf.Close() })
+
+		_, err := cf.Write([]byte("hello "))
+		r.NoErr(err)                        // should not be any error
+		r.Equal(readGzip(t, cf.Name()), "") // bytes should not be flushed within interval
+
+		clk.Set(testTime.Add(time.Minute))
+
+		_, err = cf.Write([]byte("world\n"))
+		r.NoErr(err)                                     // should not be any error
+		r.Equal(readGzip(t, cf.Name()), "hello world\n") // bytes should be flushed after interval
+	})
+
+	t.Run("reopened file is appended", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		cf := openCompressedFile(t, GzipCodec{})
+		_, err := cf.Write([]byte("hello "))
+		r.NoErr(err) // should not be any error
+		err = cf.Close()
+		r.NoErr(err) // should not be any error
+
+		file, err := os.OpenFile(cf.Name(), os.O_WRONLY|os.O_APPEND, 0644)
+		r.NoErr(err) // should not be any error
+		cf, err = NewCompressedFile(file, GzipCodec{})
+		r.NoErr(err)                 // should not be any error
+		r.Equal(cf.Size(), int64(6)) // existing uncompressed size should be counted
+
+		_, err = cf.Write([]byte("world\n"))
+		r.NoErr(err) // should not be any error
+		err = cf.Close()
+		r.NoErr(err) // should not be any error
+
+		r.Equal(readGzip(t, cf.Name()), "hello world\n") // both streams should be readable
+	})
+
+	t.Run("file reopened after crash is recovered", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		cf := openCompressedFile(t, GzipCodec{})
+		_, err := cf.Write([]byte("hello "))
+		r.NoErr(err) // should not be any error
+		err = cf.Flush()
+		r.NoErr(err) // should not be any error
+		_, err = cf.Write([]byte("unflushed"))
+		r.NoErr(err) // should not be any error
+
+		// crash, the stream is never finalized
+		err = cf.File().Close()
+		r.NoErr(err) // should not be any error
+
+		file, err := os.OpenFile(cf.Name(), os.O_WRONLY|os.O_APPEND, 0644)
+		r.NoErr(err) // should not be any error
+		cf, err = NewCompressedFile(file, GzipCodec{})
+		r.NoErr(err)                 // should not be any error
+		r.Equal(cf.Size(), int64(6)) // flushed uncompressed size should be counted
+
+		_, err = cf.Write([]byte("world\n"))
+		r.NoErr(err) // should not be any error
+		err = cf.Close()
+		r.NoErr(err) // should not be any error
+
+		data, err := ioutil.ReadFile(cf.Name())
+		r.NoErr(err) // should not be any error
+		gzr, err := gzip.NewReader(bytes.NewReader(data))
+		r.NoErr(err) // should not be any error
+		content, err := ioutil.ReadAll(gzr)
+		r.NoErr(err)                                                                  // stream should be readable to the end
+		r.Equal(string(content), "hello world\n")                                     // flushed and new content should be readable
+		r.Equal(DirFiles(t, filepath.Dir(cf.Name())), []string{"application.log.gz"}) // temp file should be removed
+	})
+}
@@ -0,0 +1,103 @@
+package barrelfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Predicate tells whether the file at the given path satisfies a condition.
+//
+// If there is any error while evaluating the condition then non-nil error is
+// returned.
+type Predicate func(path string) (bool, error)
+
+// NotEmpty is a Predicate satisfied by files which are not empty.
+func NotEmpty(path string) (bool, error) {
+	stat, err := statFile(path)
+	if err != nil {
+		return false, err
+	}
+	return stat.Size() > 0, nil
+}
+
+// LargerThan returns a Predicate satisfied by files larger than the given
+// size in bytes.
+func LargerThan(size int64) Predicate {
+	return func(path string) (bool, error) {
+		stat, err := statFile(path)
+		if err != nil {
+			return false, err
+		}
+		return stat.Size() > size, nil
+	}
+}
+
+// MatchesGlob returns a Predicate satisfied by files whose name matches the
+// given pattern, as matched by filepath.Match, eg. "*.log".
+func MatchesGlob(pattern string) Predicate {
+	return func(path string) (bool, error) {
+		match, err := filepath.Match(pattern, filepath.Base(path))
+		if err != nil {
+			return false, fmt.Errorf("match glob: %w", err)
+		}
+		return match, nil
+	}
+}
+
+// ConditionalTransformer transforms the file with the provided transformers,
+// only if the file satisfies the Condition, eg. to not compress empty files.
+type ConditionalTransformer struct {
+	// Condition the file must satisfy to be transformed, eg. NotEmpty,
+	// LargerThan(1024), or any function of the file path.
+	Condition Predicate
+
+	// Transformers transform the file if it satisfies the Condition. These are
+	// executed sequentially.
+	Transformers []Transformer
+}
+
+var _ Transformer = (*ConditionalTransformer)(nil)
+
+// Transform evaluates the Condition for the file at the given path, and if it
+// is satisfied executes the given transformers, returning the path of the
+// resulting file. Otherwise, the given path is returned unchanged.
+//
+// If there are any errors while evaluating the Condition or executing the
+// transformers then non-nil error is returned.
+func (t ConditionalTransformer) Transform(path string) (string, error) {
+	if t.Condition == nil {
+		return path, fmt.Errorf("no condition")
+	}
+	ok, err := t.Condition(path)
+	if err != nil {
+		return path, fmt.Errorf("condition: %w", err)
+	}
+	if !ok {
+		return path, nil
+	}
+	p := path
+	for i, transformer := range t.Transformers {
+		np, err := transformer.Transform(p)
+		if err != nil {
+			return path, fmt.Errorf("transformer[%d]: %w", i, err)
+		}
+		p = np
+	}
+	return p, nil
+}
+
+// statFile stats the file at the given path, failing if it is a directory.
+func statFile(path string) (os.FileInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil && os.IsNotExist(err) {
+		return nil, fmt.Errorf("no such file: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os stat: %w", err)
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("path is of a directory not a file")
+	}
+	return stat, nil
+}
@@ -0,0 +1,127 @@
+package barrelfile
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestPredicates(t *testing.T) {
+	t.Parallel()
+	r := is.New(t)
+
+	dir := SetupDir(t)
+	CleanupDir(t, dir)
+	NewFiles(t, dir, "", "empty.log")
+	NewFiles(t, dir, testText, "application.log")
+	empty := filepath.Join(dir, "empty.log")
+	file := filepath.Join(dir, "application.log")
+
+	for _, tt := range []struct {
+		name      string
+		predicate Predicate
+		path      string
+		want      bool
+		wantErr   bool
+	}{
+		{name: "not empty of empty file", predicate: NotEmpty, path: empty, want: false},
+		{name: "not empty of non empty file", predicate: NotEmpty, path: file, want: true},
+		{name: "not empty of missing file", predicate: NotEmpty, path: filepath.Join(dir, "missing.log"), wantErr: true},
+		{name: "not empty of directory", predicate: NotEmpty, path: dir, wantErr: true},
+		{name: "larger than of smaller file", predicate: LargerThan(int64(len(testText))), path: file, want: false},
+		{name: "larger than of larger file", predicate: LargerThan(int64(len(testText)) - 1), path: file, want: true},
+		{name: "matches glob", predicate: MatchesGlob("app*.log"), path: file, want: true},
+		{name: "does not match glob", predicate: MatchesGlob("*.txt"), path: file, want: false},
+		{name: "malformed glob", predicate: MatchesGlob("[app"), path: file, wantErr: true},
+	} {
+		v, err := tt.predicate(tt.path)
+		r.Equal(err != nil, tt.wantErr) // error should be as expected
+		r.Equal(v, tt.want)             // predicate should be satisfied as expected
+	}
+}
+
+func TestConditionalTransformer_Transform(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no condition", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		path, err := ConditionalTransformer{}.Transform("application.log")
+		r.True(err != nil)               // should be non nil
+		r.Equal(path, "application.log") // path returned should be same as given path
+	})
+
+	t.Run("condition satisfied", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log")
+		file := filepath.Join(dir, "application.log")
+
+		transformer := ConditionalTransformer{
+			Condition:    NotEmpty,
+			Transformers: []Transformer{GzipTransformer{}},
+		}
+		path, err := transformer.Transform(file)
+		r.NoErr(err)                                              // should not be any error
+		r.Equal(path, file+".gz")                                 // path of the transformed file should be returned
+		r.Equal(DirFiles(t, dir), []string{"application.log.gz"}) // file should be transformed
+	})
+
+	t.Run("condition not satisfied", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "", "application.log")
+		file := filepath.Join(dir, "application.log")
+
+		transformer := ConditionalTransformer{
+			Condition:    NotEmpty,
+			Transformers: []Transformer{GzipTransformer{}},
+		}
+		path, err := transformer.Transform(file)
+		r.NoErr(err)                                           // should not be any error
+		r.Equal(path, file)                                    // path should be unchanged
+		r.Equal(DirFiles(t, dir), []string{"application.log"}) // file should not be transformed
+	})
+
+	t.Run("custom condition error", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		transformer := ConditionalTransformer{
+			Condition: func(path string) (bool, error) {
+				return false, errors.New("condition error")
+			},
+			Transformers: []Transformer{GzipTransformer{}},
+		}
+		path, err := transformer.Transform("application.log")
+		r.True(err != nil)               // should be non nil
+		r.Equal(path, "application.log") // path returned should be same as given path
+	})
+
+	t.Run("transformer error", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log")
+		file := filepath.Join(dir, "application.log")
+
+		transformer := ConditionalTransformer{
+			Condition:    LargerThan(0),
+			Transformers: []Transformer{GzipTransformer{}, GzipTransformer{}, CompressTransformer{}},
+		}
+		path, err := transformer.Transform(file)
+		r.True(err != nil)  // should be non nil
+		r.Equal(path, file) // path returned should be same as given path
+	})
+}
@@ -0,0 +1,130 @@
+package barrelfile
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// DelayCompressTransformer compresses the archives of the file, but leaves the
+// newest archives uncompressed, like delaycompress of logrotate. It is
+// expected to be used after the transformers generating the archive, in place
+// of compressing transformers.
+//
+// It is useful when processes may keep writing to the file for a while after
+// the rotation, through their already open file descriptors. An archive is
+// compressed on a later rotation, once newer archives are generated, or by
+// Sweep once it has not been modified for GracePeriod.
+type DelayCompressTransformer struct {
+	// Parser used to discover the archives of the file, it should correspond
+	// to the Namer generating the archives.
+	Parser Parser
+
+	// Dir is the directory searched, including nested directories, for the
+	// archives. If unset, it will correspond to the directory of the file.
+	Dir string
+
+	// Codec used to compress the archives. If unset, it will correspond to
+	// GzipCodec with default compression.
+	Codec Codec
+
+	// Delay is the number of newest archives left uncompressed. If unset
+	// (ie. 0), it will correspond to 1.
+	Delay int
+
+	// GracePeriod after which an archive not modified anymore is compressed,
+	// even if it is one of the newest. If unset (ie. 0), newest archives are
+	// never compressed.
+	GracePeriod time.Duration
+
+	// NowFunc to wrap stdlib time.Now for testing.
+	NowFunc func() time.Time
+
+	// Logger logs the compressed archives. If unset, nothing is logged.
+	Logger *log.Logger
+}
+
+// Transform discovers the archives of the file, which the file at the given
+// path is an archive of, as parsed by the Parser, and compresses the
+// uncompressed archives except the newest ones. If the given path is not of an
+// archive, then it is considered as the file itself. The given path is
+// returned unchanged, as the newest archive is not compressed.
+//
+// If there are any errors while discovering or compressing the archives then
+// non-nil error is returned.
+func (t DelayCompressTransformer) Transform(path string) (string, error) {
+	current := path
+	if archive, err := t.Parser.Parse(path); err == nil {
+		current = filepath.Join(filepath.Dir(path), archive.Name())
+	}
+	if err := t.Sweep(current); err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// Sweep discovers the archives of the file at current path, as parsed by the
+// Parser, and compresses the uncompressed archives except the newest ones
+// which were modified within GracePeriod. It should be called at startup to
+// compress the archives left uncompressed by the previous run.
+//
+// If there are any errors while discovering or compressing the archives then
+// non-nil error is returned.
+func (t DelayCompressTransformer) Sweep(current string) error {
+	dir := t.Dir
+	if len(dir) == 0 {
+		dir = filepath.Dir(current)
+	}
+
+	archives, err := FindArchives(dir, current, t.Parser)
+	if err != nil {
+		return fmt.Errorf("find archives: %w", err)
+	}
+	codec := t.Codec
+	if codec == nil {
+		codec = GzipCodec{}
+	}
+	for _, archive := range t.pending(archives) {
+		if _, err := (CompressTransformer{Codec: codec}).Transform(archive.Path); err != nil {
+			return fmt.Errorf("compress archive: %w", err)
+		}
+		logf(t.Logger, "delay compress: compressed %s", archive.Path)
+	}
+	return nil
+}
+
+// StartSweep runs Sweep for the file at current path every interval in a
+// separate goroutine, until the returned stop function is called. Errors are
+// logged to the Logger.
+func (t DelayCompressTransformer) StartSweep(current string, interval time.Duration) (stop func()) {
+	return startSweep(interval, func() error { return t.Sweep(current) }, t.Logger, "delay compress: sweep "+current)
+}
+
+// pending returns the uncompressed archives to be compressed, from the given
+// archives ordered from the oldest to the newest.
+func (t DelayCompressTransformer) pending(archives []Archive) []Archive {
+	var nowTime time.Time
+	if t.NowFunc != nil {
+		nowTime = t.NowFunc()
+	} else {
+		nowTime = time.Now()
+	}
+	delay := t.Delay
+	if delay <= 0 {
+		delay = 1
+	}
+
+	var pending []Archive
+	for i, archive := range archives {
+		if len(archive.Suffix) != 0 {
+			continue
+		}
+		newest := i >= len(archives)-delay
+		if newest && (t.GracePeriod <= 0 || nowTime.Sub(archive.ModTime) < t.GracePeriod) {
+			continue
+		}
+		pending = append(pending, archive)
+	}
+	return pending
+}
@@ -0,0 +1,177 @@
+package barrelfile
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestDelayCompressTransformer_Transform(t *testing.T) {
+	t.Parallel()
+
+	t.Run("newest archive is not compressed", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t, "application.log.1")
+
+		transformer := DelayCompressTransformer{Parser: ShiftingNamer{}}
+
+		path, err := transformer.Transform(filepath.Join(dir, "application.log.1"))
+		r.NoErr(err)                                           // should not be any error
+		r.Equal(path, filepath.Join(dir, "application.log.1")) // path should be unchanged
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1", "other.log.1"})
+	})
+
+	t.Run("previous archive is compressed", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t,
+			"application_2021-01-01.0.log.gz",
+			"application_2021-01-02.0.log",
+			"application_2021-01-03.0.log",
+		)
+
+		var logs bytes.Buffer
+		transformer := DelayCompressTransformer{Parser: TimestampSequenceNamer{}, Logger: log.New(&logs, "", 0)}
+
+		_, err := transformer.Transform(filepath.Join(dir, "application_2021-01-03.0.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application_2021-01-01.0.log.gz",
+			"application_2021-01-02.0.log.gz",
+			"application_2021-01-03.0.log",
+			"other.log.1",
+		})
+		r.True(strings.Contains(logs.String(), "compressed "+filepath.Join(dir, "application_2021-01-02.0.log"))) // compression should be logged
+	})
+
+	t.Run("delay of multiple archives with codec", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t, "application.log.3", "application.log.2", "application.log.1")
+
+		transformer := DelayCompressTransformer{Parser: ShiftingNamer{}, Codec: ZlibCodec{}, Delay: 2}
+
+		_, err := transformer.Transform(filepath.Join(dir, "application.log.1"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1", "application.log.2", "application.log.3.zz", "other.log.1"})
+	})
+
+	t.Run("existing compressed archive is not overwritten", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t, "application.log.2.gz", "application.log.2", "application.log.1")
+		NewFiles(t, dir, "compressed", "application.log.2.gz")
+
+		_, err := DelayCompressTransformer{Parser: ShiftingNamer{}}.Transform(filepath.Join(dir, "application.log.1"))
+		r.True(errors.Is(err, os.ErrExist)) // error should wrap os.ErrExist
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "application.log.2.gz"))
+		r.NoErr(err)                        // should not be any error
+		r.Equal(string(data), "compressed") // existing compressed archive should not be overwritten
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1", "application.log.2", "application.log.2.gz", "other.log.1"})
+	})
+
+	t.Run("compressed archive decompresses to original content", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t, "application.log.2", "application.log.1")
+
+		_, err := DelayCompressTransformer{Parser: ShiftingNamer{}}.Transform(filepath.Join(dir, "application.log.1"))
+		r.NoErr(err) // should not be any error
+
+		file, err := os.Open(filepath.Join(dir, "application.log.2.gz"))
+		r.NoErr(err) // should not be any error
+		defer func() { _ = file.Close() }()
+		rd, err := GzipCodec{}.NewReader(file)
+		r.NoErr(err) // should not be any error
+		var content bytes.Buffer
+		_, err = content.ReadFrom(rd)
+		r.NoErr(err)                         // should not be any error
+		r.Equal(content.String(), "archive") // content should be same as original
+	})
+}
+
+func TestDelayCompressTransformer_Sweep(t *testing.T) {
+	t.Parallel()
+
+	t.Run("leftovers are compressed", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "archive", "application.log", "application.log.1", "application.log.2", "application.log.3")
+
+		transformer := DelayCompressTransformer{Parser: ShiftingNamer{}}
+
+		err := transformer.Sweep(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1", "application.log.2.gz", "application.log.3.gz"})
+	})
+
+	t.Run("newest archive is compressed after grace period", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "archive", "application.log", "application.log.1")
+		err := os.Chtimes(filepath.Join(dir, "application.log.1"), testTime, testTime)
+		r.NoErr(err) // should not be any error
+
+		clk := clock{}
+		clk.Set(testTime.Add(time.Minute))
+		transformer := DelayCompressTransformer{Parser: ShiftingNamer{}, GracePeriod: time.Hour, NowFunc: clk.Now}
+
+		err = transformer.Sweep(filepath.Join(dir, "application.log"))
+		r.NoErr(err)                                                                // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1"}) // archive within grace period should not be compressed
+
+		clk.Set(testTime.Add(2 * time.Hour))
+
+		err = transformer.Sweep(filepath.Join(dir, "application.log"))
+		r.NoErr(err)                                                                   // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1.gz"}) // archive after grace period should be compressed
+	})
+
+	t.Run("start sweep", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "archive", "application.log", "application.log.1")
+		err := os.Chtimes(filepath.Join(dir, "application.log.1"), testTime, testTime)
+		r.NoErr(err) // should not be any error
+
+		transformer := DelayCompressTransformer{Parser: ShiftingNamer{}, GracePeriod: time.Hour}
+
+		stop := transformer.StartSweep(filepath.Join(dir, "application.log"), time.Millisecond)
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if _, err := os.Stat(filepath.Join(dir, "application.log.1.gz")); err == nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		stop()
+		stop() // should be safe to stop again
+
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1.gz"}) // archive should be compressed by sweep
+	})
+}
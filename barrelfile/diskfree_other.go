@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package barrelfile
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// diskFree always returns a non-nil error as checking free space is not
+// supported on this platform.
+func diskFree(_ string) (uint64, error) {
+	return 0, fmt.Errorf("disk free unsupported on %s", runtime.GOOS)
+}
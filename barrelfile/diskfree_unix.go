@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package barrelfile
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// diskFree returns the number of bytes available to unprivileged users on the
+// file system containing the given path.
+func diskFree(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("statfs: %w", err)
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,358 @@
+package barrelfile
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EncryptExt is the extension added to archives encrypted by EncryptTransformer.
+const EncryptExt = ".enc"
+
+// DefaultEncryptChunkSize is the size of plaintext chunks encrypted by
+// EncryptTransformer, if no chunk size is given.
+const DefaultEncryptChunkSize = 64 << 10
+
+// MaxEncryptChunkSize is the largest size of plaintext chunks, so that a
+// crafted archive cannot force large allocations on decryption.
+const MaxEncryptChunkSize = 4 << 20
+
+// encryptMagic identifies the encrypted format, followed by its version.
+var encryptMagic = [6]byte{'B', 'R', 'L', 'E', 'N', 'C'}
+
+const (
+	encryptVersion  = 1
+	encryptSaltSize = 32
+	encryptKeySize  = 32
+)
+
+// KeyProvider provides the keys for encryption and decryption of archives.
+// Keys are identified by IDs recorded in the encrypted archives, so that the
+// key used for encryption can be rotated, while the archives encrypted with
+// the previous keys remain decryptable.
+type KeyProvider interface {
+	// CurrentKey returns the ID and the 32 byte key used to encrypt new
+	// archives.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the 32 byte key with the given ID, used to decrypt archives.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider with fixed set of keys.
+type StaticKeyProvider struct {
+	// CurrentID is the ID of the key used for encryption.
+	CurrentID string
+
+	// Keys by their IDs.
+	Keys map[string][]byte
+}
+
+var _ KeyProvider = (*StaticKeyProvider)(nil)
+
+// CurrentKey returns the key with CurrentID.
+func (p StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	key, err := p.Key(p.CurrentID)
+	if err != nil {
+		return "", nil, err
+	}
+	return p.CurrentID, key, nil
+}
+
+// Key returns the key with the given ID.
+func (p StaticKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+// EncryptTransformer encrypts the file with AES-256-GCM.
+//
+// The file is encrypted in chunks, so that it is never held in memory as a
+// whole, following the STREAM construction: every chunk is sealed with a
+// nonce of chunk counter and a flag marking the last chunk, so that
+// reordering, removal and truncation of chunks is detected on decryption.
+// Every file is encrypted with its own key, derived from the key of the
+// KeyProvider and a random salt, so that nonces are never reused.
+//
+// The format is a header of the magic "BRLENC", version, length of key ID, key
+// ID, chunk size and salt, followed by the sealed chunks. The header is
+// authenticated with every chunk.
+type EncryptTransformer struct {
+	// Keys provides the key used for encryption.
+	Keys KeyProvider
+
+	// ChunkSize is the size of plaintext chunks, at most MaxEncryptChunkSize.
+	// If unset (ie. 0), DefaultEncryptChunkSize is used.
+	ChunkSize int
+}
+
+var _ Transformer = (*EncryptTransformer)(nil)
+
+// Transform encrypts the file at the given path. The resulting encrypted file
+// is created in the same directory as the original file, but EncryptExt is
+// added to the file name, and the original file is removed.
+//
+// If there are any error while encrypting the file at given path, or the
+// encrypted file already exists, then non-nil error is returned.
+func (t EncryptTransformer) Transform(path string) (string, error) {
+	if t.Keys == nil {
+		return path, fmt.Errorf("no key provider")
+	}
+	encPath := path + EncryptExt
+	newWriter := func(w io.Writer) (io.WriteCloser, error) {
+		return NewEncryptWriter(w, t.Keys, t.ChunkSize)
+	}
+	if err := fileCompress(path, encPath, newWriter, nil); err != nil {
+		return path, fmt.Errorf("encrypt: %w", err)
+	}
+	return encPath, nil
+}
+
+// encryptWriter encrypts the bytes written to it into the underlying writer.
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+
+	chunkSize int
+	buf       []byte
+	counter   uint32
+	closed    bool
+}
+
+// NewEncryptWriter returns a writer encrypting the bytes written to it into w,
+// with the current key of the given KeyProvider, in chunks of chunkSize bytes.
+// If chunkSize is not positive DefaultEncryptChunkSize is used, and it must
+// not exceed MaxEncryptChunkSize. The writer must be closed to write the last
+// chunk, it does not close w.
+func NewEncryptWriter(w io.Writer, keys KeyProvider, chunkSize int) (io.WriteCloser, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultEncryptChunkSize
+	}
+	if chunkSize > MaxEncryptChunkSize {
+		return nil, fmt.Errorf("chunk size greater than %d", MaxEncryptChunkSize)
+	}
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return nil, fmt.Errorf("current key: %w", err)
+	}
+	if len(id) > 255 {
+		return nil, fmt.Errorf("key id longer than 255 bytes")
+	}
+	salt := make([]byte, encryptSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	aead, err := newFileAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	header.Write(encryptMagic[:])
+	header.WriteByte(encryptVersion)
+	header.WriteByte(byte(len(id)))
+	header.WriteString(id)
+	_ = binary.Write(&header, binary.BigEndian, uint32(chunkSize))
+	header.Write(salt)
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+	return &encryptWriter{
+		w:         w,
+		aead:      aead,
+		header:    header.Bytes(),
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Write encrypts p. A chunk is sealed only once bytes following it are
+// written, as the last chunk is sealed differently on Close.
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, fmt.Errorf("write to closed encrypt writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(ew.buf) == ew.chunkSize {
+			if err := ew.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(ew.buf[len(ew.buf):ew.chunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+c]
+		n += c
+		p = p[c:]
+	}
+	return n, nil
+}
+
+// Close seals the last chunk.
+func (ew *encryptWriter) Close() error {
+	if ew.closed {
+		return fmt.Errorf("close closed encrypt writer")
+	}
+	ew.closed = true
+	return ew.seal(true)
+}
+
+func (ew *encryptWriter) seal(last bool) error {
+	if ew.counter == ^uint32(0) {
+		return fmt.Errorf("too many chunks")
+	}
+	sealed := ew.aead.Seal(ew.buf[:0], chunkNonce(ew.counter, last), ew.buf, ew.header)
+	ew.counter++
+	if _, err := ew.w.Write(sealed); err != nil {
+		return fmt.Errorf("write chunk: %w", err)
+	}
+	ew.buf = ew.buf[:0]
+	return nil
+}
+
+// decryptReader decrypts the bytes read from the underlying reader.
+type decryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+
+	chunk   []byte
+	plain   []byte
+	counter uint32
+	peek    []byte
+	done    bool
+}
+
+// NewDecryptReader returns a reader decrypting the archive read from r, as
+// encrypted by EncryptTransformer, with the key of the given KeyProvider with
+// the ID recorded in the archive.
+//
+// If the archive has been modified or truncated, then reads return error
+// wrapping ErrDecrypt.
+func NewDecryptReader(r io.Reader, keys KeyProvider) (io.Reader, error) {
+	var prefix [len(encryptMagic) + 2]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if !bytes.Equal(prefix[:len(encryptMagic)], encryptMagic[:]) {
+		return nil, fmt.Errorf("not an encrypted archive")
+	}
+	if version := prefix[len(encryptMagic)]; version != encryptVersion {
+		return nil, fmt.Errorf("unsupported encryption version %d", version)
+	}
+	rest := make([]byte, int(prefix[len(encryptMagic)+1])+4+encryptSaltSize)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	idLen := int(prefix[len(encryptMagic)+1])
+	id := string(rest[:idLen])
+	chunkSize := binary.BigEndian.Uint32(rest[idLen:])
+	salt := rest[idLen+4:]
+	if chunkSize == 0 || chunkSize > MaxEncryptChunkSize {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+
+	key, err := keys.Key(id)
+	if err != nil {
+		return nil, fmt.Errorf("key: %w", err)
+	}
+	aead, err := newFileAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:      r,
+		aead:   aead,
+		header: append(prefix[:], rest...),
+		chunk:  make([]byte, int(chunkSize)+aead.Overhead()),
+	}, nil
+}
+
+// Read decrypts the bytes of the archive, chunk by chunk.
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+// open reads and opens the next chunk. A chunk is the last one, if it is
+// shorter than a full chunk, or no bytes follow it.
+func (dr *decryptReader) open() error {
+	n := copy(dr.chunk, dr.peek)
+	dr.peek = nil
+	m, err := io.ReadFull(dr.r, dr.chunk[n:])
+	n += m
+	last := false
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return fmt.Errorf("read chunk: %w", err)
+	default:
+		var next [1]byte
+		k, err := io.ReadFull(dr.r, next[:])
+		if errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return fmt.Errorf("read chunk: %w", err)
+		}
+		dr.peek = next[:k]
+	}
+	plain, err := dr.aead.Open(dr.chunk[:0], chunkNonce(dr.counter, last), dr.chunk[:n], dr.header)
+	if err != nil {
+		return fmt.Errorf("open chunk %d: %w", dr.counter, ErrDecrypt)
+	}
+	dr.counter++
+	dr.plain = plain
+	dr.done = last
+	return nil
+}
+
+// newFileAEAD returns AES-256-GCM with the key of a file, derived from the
+// given key and salt of the file with HMAC-SHA256.
+func newFileAEAD(key, salt []byte) (cipher.AEAD, error) {
+	if len(key) != encryptKeySize {
+		return nil, fmt.Errorf("key must be %d bytes for AES-256", encryptKeySize)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("barrel file key"))
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("new aes cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("new gcm: %w", err)
+	}
+	return aead, nil
+}
+
+// chunkNonce returns the nonce of the chunk with the given counter, as 7 zero
+// bytes, big endian counter, and 1 for the last chunk or 0 otherwise.
+func chunkNonce(counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint32(nonce[7:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
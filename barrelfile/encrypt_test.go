@@ -0,0 +1,203 @@
+package barrelfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestEncrypt(t *testing.T) {
+	t.Parallel()
+
+	keys := StaticKeyProvider{
+		CurrentID: "2021-02",
+		Keys: map[string][]byte{
+			"2021-01": bytes.Repeat([]byte{1}, 32),
+			"2021-02": bytes.Repeat([]byte{2}, 32),
+		},
+	}
+
+	// encrypt encrypts content in chunks of chunkSize with the given keys.
+	encrypt := func(t *testing.T, keys KeyProvider, content []byte, chunkSize int) []byte {
+		r := is.New(t)
+
+		var buf bytes.Buffer
+		ew, err := NewEncryptWriter(&buf, keys, chunkSize)
+		r.NoErr(err) // should not be any error
+		_, err = ew.Write(content)
+		r.NoErr(err) // should not be any error
+		err = ew.Close()
+		r.NoErr(err) // should not be any error
+		return buf.Bytes()
+	}
+
+	for _, size := range []int{0, 1, 15, 16, 17, 64, 1000} {
+		size := size
+		t.Run(fmt.Sprintf("round trip %d bytes", size), func(t *testing.T) {
+			t.Parallel()
+			r := is.New(t)
+
+			content := gzipTestData(size)
+			encrypted := encrypt(t, keys, content, 16)
+			r.True(size < 16 || !bytes.Contains(encrypted, content)) // content should not be in plaintext
+
+			dr, err := NewDecryptReader(bytes.NewReader(encrypted), keys)
+			r.NoErr(err) // should not be any error
+			decrypted, err := ioutil.ReadAll(dr)
+			r.NoErr(err)                            // should not be any error
+			r.True(bytes.Equal(decrypted, content)) // decrypted content should be same as original
+		})
+	}
+
+	t.Run("same content encrypts differently", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		content := []byte(testText)
+		r.True(!bytes.Equal(encrypt(t, keys, content, 0), encrypt(t, keys, content, 0))) // every file should have own key
+	})
+
+	t.Run("decrypt with rotated keys", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		old := StaticKeyProvider{CurrentID: "2021-01", Keys: keys.Keys}
+		encrypted := encrypt(t, old, []byte(testText), 0)
+
+		dr, err := NewDecryptReader(bytes.NewReader(encrypted), keys)
+		r.NoErr(err) // should not be any error
+		decrypted, err := ioutil.ReadAll(dr)
+		r.NoErr(err)                         // should not be any error
+		r.Equal(string(decrypted), testText) // archive should be decrypted with key of its ID
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		encrypted := encrypt(t, keys, []byte(testText), 0)
+
+		_, err := NewDecryptReader(bytes.NewReader(encrypted), StaticKeyProvider{Keys: map[string][]byte{}})
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, err := NewEncryptWriter(&bytes.Buffer{}, StaticKeyProvider{CurrentID: "short", Keys: map[string][]byte{"short": []byte("short")}}, 0)
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		encrypted := encrypt(t, keys, []byte(testText), 0)
+
+		wrong := StaticKeyProvider{Keys: map[string][]byte{"2021-02": bytes.Repeat([]byte{3}, 32)}}
+		dr, err := NewDecryptReader(bytes.NewReader(encrypted), wrong)
+		r.NoErr(err) // should not be any error
+		_, err = ioutil.ReadAll(dr)
+		r.True(errors.Is(err, ErrDecrypt)) // error should wrap ErrDecrypt
+	})
+
+	t.Run("tampered archives", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		content := gzipTestData(100)
+		encrypted := encrypt(t, keys, content, 16)
+		headerSize := len(encryptMagic) + 2 + len("2021-02") + 4 + encryptSaltSize
+		chunkSize := 16 + 16
+
+		modified := append([]byte(nil), encrypted...)
+		modified[headerSize+5] ^= 1
+
+		swapped := append([]byte(nil), encrypted...)
+		copy(swapped[headerSize:], encrypted[headerSize+chunkSize:headerSize+2*chunkSize])
+		copy(swapped[headerSize+chunkSize:], encrypted[headerSize:headerSize+chunkSize])
+
+		truncated := encrypted[:headerSize+2*chunkSize]
+
+		removed := append(append([]byte(nil), encrypted[:headerSize+chunkSize]...), encrypted[headerSize+2*chunkSize:]...)
+
+		for _, tampered := range [][]byte{modified, swapped, truncated, removed, encrypted[:headerSize]} {
+			dr, err := NewDecryptReader(bytes.NewReader(tampered), keys)
+			r.NoErr(err) // should not be any error
+			_, err = ioutil.ReadAll(dr)
+			r.True(errors.Is(err, ErrDecrypt)) // error should wrap ErrDecrypt
+		}
+
+		_, err := NewDecryptReader(bytes.NewReader([]byte(testText)), keys)
+		r.True(err != nil) // other content should be non nil error
+	})
+
+	t.Run("chunk size too large", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, err := NewEncryptWriter(&bytes.Buffer{}, keys, MaxEncryptChunkSize+1)
+		r.True(err != nil) // should be non nil
+
+		encrypted := encrypt(t, keys, []byte(testText), 0)
+		crafted := append([]byte(nil), encrypted...)
+		binary.BigEndian.PutUint32(crafted[len(encryptMagic)+2+len("2021-02"):], 1<<30)
+
+		_, err = NewDecryptReader(bytes.NewReader(crafted), keys)
+		r.True(err != nil) // crafted chunk size should be non nil error
+	})
+}
+
+func TestEncryptTransformer_Transform(t *testing.T) {
+	t.Parallel()
+
+	keys := StaticKeyProvider{CurrentID: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+
+	t.Run("no key provider", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		file := NewFile(t, dir, "encrypt-transformer-*")
+
+		path, err := EncryptTransformer{}.Transform(file)
+		r.True(err != nil)   // should be non nil
+		r.True(path == file) // path returned should be same as given path
+	})
+
+	t.Run("transform file at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log.1.gz")
+		file := filepath.Join(dir, "application.log.1.gz")
+
+		path, err := EncryptTransformer{Keys: keys, ChunkSize: 100}.Transform(file)
+		r.NoErr(err)               // should not be any error
+		r.Equal(path, file+".enc") // ".enc" extension should be added
+		r.Equal(DirFiles(t, dir), []string{"application.log.1.gz.enc"})
+
+		encrypted, err := os.Open(path)
+		r.NoErr(err) // should not be any error
+		defer func() { _ = encrypted.Close() }()
+		dr, err := NewDecryptReader(encrypted, keys)
+		r.NoErr(err) // should not be any error
+		decrypted, err := ioutil.ReadAll(dr)
+		r.NoErr(err)                         // should not be any error
+		r.Equal(string(decrypted), testText) // decrypted content should be same as original
+
+		archive, err := ShiftingNamer{}.Parse(path)
+		r.NoErr(err)                       // should not be any error
+		r.Equal(archive.Suffix, ".gz.enc") // encryption extension should be part of suffix
+	})
+}
@@ -0,0 +1,20 @@
+package barrelfile
+
+const (
+	// ErrNotArchive is returned when a path cannot be parsed as an archive.
+	ErrNotArchive = barrelfileError("not an archive")
+
+	// ErrChecksumMismatch is returned when a file does not match its recorded
+	// checksum.
+	ErrChecksumMismatch = barrelfileError("checksum mismatch")
+
+	// ErrDecrypt is returned when an encrypted archive cannot be decrypted,
+	// as it has been modified, truncated or encrypted with another key.
+	ErrDecrypt = barrelfileError("message authentication failed")
+)
+
+type barrelfileError string
+
+func (e barrelfileError) Error() string {
+	return string(e)
+}
@@ -0,0 +1,403 @@
+package barrelfile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DefaultLedgerName is the name of the ledger file in the directory of the
+// archives, used by LedgerTransformer if no ledger path is given.
+const DefaultLedgerName = "ledger.jsonl"
+
+// LedgerEntry records an archive in a ledger. Every entry includes the SHA-256
+// digest of the archive, and the hash of the previous entry, chaining the
+// entries together, and is signed with ed25519. So no archive or entry can be
+// altered, removed or reordered without detection, except for the last entries
+// cut off the end of the ledger, which are detected only when verified against
+// a LedgerCheckpoint kept out of band.
+type LedgerEntry struct {
+	// Sequence of the entry in the ledger, starting from 1.
+	Sequence uint64 `json:"seq"`
+
+	// Time at which the archive was recorded.
+	Time time.Time `json:"time"`
+
+	// Name of the archive, relative to the directory of the ledger.
+	Name string `json:"name"`
+
+	// Size of the archive.
+	Size int64 `json:"size"`
+
+	// Digest is the hex encoded SHA-256 digest of the archive.
+	Digest string `json:"sha256"`
+
+	// Prev is the hex encoded Hash of the previous entry, empty for the first
+	// entry.
+	Prev string `json:"prev"`
+
+	// Signature is the hex encoded ed25519 signature of the Hash of the entry.
+	Signature string `json:"sig"`
+}
+
+// Hash returns the SHA-256 hash of the entry, excluding its Signature.
+func (e LedgerEntry) Hash() []byte {
+	h := sha256.New()
+	for _, field := range []string{
+		"barrel ledger v1",
+		strconv.FormatUint(e.Sequence, 10),
+		e.Time.UTC().Format(time.RFC3339Nano),
+		e.Name,
+		strconv.FormatInt(e.Size, 10),
+		e.Digest,
+		e.Prev,
+	} {
+		// length prefix keeps fields unambiguous.
+		_, _ = fmt.Fprintf(h, "%d:%s", len(field), field)
+	}
+	return h.Sum(nil)
+}
+
+// LedgerTransformer records the file in a signed, hash chained ledger, it is
+// expected to be used after the transformers generating the final archive.
+// The ledger is verified with VerifyLedger.
+//
+// The ledger is a file of JSON encoded LedgerEntry, one per line. It must not
+// be appended to concurrently, by multiple transformers or processes.
+type LedgerTransformer struct {
+	// Ledger is the path of the ledger file. If unset, it will correspond to
+	// DefaultLedgerName in the directory of the file.
+	Ledger string
+
+	// PrivateKey used to sign the entries.
+	PrivateKey ed25519.PrivateKey
+
+	// Checkpoint is called with the checkpoint of the ledger after every
+	// appended entry, to keep it out of band, eg. to publish it or send it to
+	// another machine. If unset, no checkpoint is kept.
+	Checkpoint func(checkpoint LedgerCheckpoint) error
+
+	// NowFunc to wrap stdlib time.Now for testing.
+	NowFunc func() time.Time
+}
+
+var _ Transformer = (*LedgerTransformer)(nil)
+
+// LedgerCheckpoint identifies the last entry of a ledger. As the entries are
+// chained, a checkpoint kept out of band commits to all the entries up to it,
+// so that entries cut off the end of the ledger are detected by VerifyLedger.
+type LedgerCheckpoint struct {
+	// Sequence of the last entry.
+	Sequence uint64 `json:"seq"`
+
+	// Hash is the hex encoded Hash of the last entry.
+	Hash string `json:"hash"`
+}
+
+// ReadLedgerCheckpoint returns the checkpoint of the last entry of the ledger
+// at the given path.
+//
+// If there are any errors while reading the ledger, or the ledger is empty
+// then non-nil error is returned.
+func ReadLedgerCheckpoint(path string) (LedgerCheckpoint, error) {
+	entries, err := readLedger(path)
+	if err != nil {
+		return LedgerCheckpoint{}, fmt.Errorf("read ledger: %w", err)
+	}
+	if len(entries) == 0 {
+		return LedgerCheckpoint{}, fmt.Errorf("empty ledger")
+	}
+	last := entries[len(entries)-1]
+	return LedgerCheckpoint{Sequence: last.Sequence, Hash: hex.EncodeToString(last.Hash())}, nil
+}
+
+// Transform computes the digest of the file at the given path, and appends a
+// signed entry for it, chained to the last entry, to the ledger, and passes
+// the new checkpoint to Checkpoint. The given path is returned unchanged.
+//
+// If there are any errors while reading the ledger, computing the digest,
+// appending the entry or keeping the checkpoint then non-nil error is
+// returned.
+func (t LedgerTransformer) Transform(path string) (string, error) {
+	if len(t.PrivateKey) != ed25519.PrivateKeySize {
+		return path, fmt.Errorf("invalid private key")
+	}
+	ledger := t.Ledger
+	if len(ledger) == 0 {
+		ledger = filepath.Join(filepath.Dir(path), DefaultLedgerName)
+	}
+	name, err := ledgerName(ledger, path)
+	if err != nil {
+		return path, err
+	}
+	digest, _, size, err := fileChecksums(path)
+	if err != nil {
+		return path, fmt.Errorf("digest: %w", err)
+	}
+	entries, err := readLedger(ledger)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return path, fmt.Errorf("read ledger: %w", err)
+	}
+
+	var nowTime time.Time
+	if t.NowFunc != nil {
+		nowTime = t.NowFunc()
+	} else {
+		nowTime = time.Now()
+	}
+	entry := LedgerEntry{Sequence: 1, Time: nowTime, Name: name, Size: size, Digest: digest}
+	if len(entries) != 0 {
+		last := entries[len(entries)-1]
+		entry.Sequence = last.Sequence + 1
+		entry.Prev = hex.EncodeToString(last.Hash())
+	}
+	entry.Signature = hex.EncodeToString(ed25519.Sign(t.PrivateKey, entry.Hash()))
+
+	if err := appendLedger(ledger, entry); err != nil {
+		return path, fmt.Errorf("append ledger: %w", err)
+	}
+	if t.Checkpoint != nil {
+		checkpoint := LedgerCheckpoint{Sequence: entry.Sequence, Hash: hex.EncodeToString(entry.Hash())}
+		if err := t.Checkpoint(checkpoint); err != nil {
+			return path, fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// LedgerProblemKind is the kind of a problem found by VerifyLedger.
+type LedgerProblemKind int
+
+const (
+	// LedgerInvalidSignature is an entry whose signature is not valid.
+	LedgerInvalidSignature LedgerProblemKind = iota + 1
+
+	// LedgerGap is a missing entry, ie. a sequence not present in the ledger.
+	LedgerGap
+
+	// LedgerReordered is an entry appearing after an entry with a higher
+	// sequence, or repeating a sequence.
+	LedgerReordered
+
+	// LedgerBrokenChain is an entry not chained to the previous entry, ie.
+	// the previous entry has been altered or replaced.
+	LedgerBrokenChain
+
+	// LedgerModified is an archive not matching the digest of its entry.
+	LedgerModified
+
+	// LedgerMissing is an archive which no longer exists, eg. removed by
+	// retention.
+	LedgerMissing
+
+	// LedgerTruncated is the entry of the checkpoint not present in the
+	// ledger, ie. the entries up to it have been cut off the end of the
+	// ledger.
+	LedgerTruncated
+
+	// LedgerCheckpointMismatch is the entry of the checkpoint not matching
+	// the hash of the checkpoint, ie. it has been altered or replaced.
+	LedgerCheckpointMismatch
+)
+
+// String returns the name of the kind.
+func (k LedgerProblemKind) String() string {
+	switch k {
+	case LedgerInvalidSignature:
+		return "invalid signature"
+	case LedgerGap:
+		return "gap"
+	case LedgerReordered:
+		return "reordered"
+	case LedgerBrokenChain:
+		return "broken chain"
+	case LedgerModified:
+		return "modified"
+	case LedgerMissing:
+		return "missing"
+	case LedgerTruncated:
+		return "truncated"
+	case LedgerCheckpointMismatch:
+		return "checkpoint mismatch"
+	}
+	return "unknown"
+}
+
+// LedgerProblem describes a problem found by VerifyLedger.
+type LedgerProblem struct {
+	// Kind of the problem.
+	Kind LedgerProblemKind
+
+	// Sequence of the entry with the problem, or the missing sequence.
+	Sequence uint64
+
+	// Name of the archive of the entry, empty for gaps.
+	Name string
+}
+
+// String describes the problem.
+func (p LedgerProblem) String() string {
+	if len(p.Name) == 0 {
+		return fmt.Sprintf("%s: entry %d", p.Kind, p.Sequence)
+	}
+	return fmt.Sprintf("%s: entry %d: %s", p.Kind, p.Sequence, p.Name)
+}
+
+// VerifyLedger walks the chain of entries of the ledger at the given path,
+// verifying their signatures with the given public key, and the archives,
+// looked up relative to the directory of the ledger, against their digests.
+//
+// If checkpoint is not nil, the ledger is also verified to contain the entry of
+// the checkpoint, so that entries cut off the end of the ledger are detected.
+// Without a checkpoint, a ledger missing its last entries is valid.
+//
+// The problems found are returned in the order of the ledger, followed by the
+// gaps, and the problem with the checkpoint. Archives removed intentionally,
+// eg. by retention, are reported as LedgerMissing, which callers may ignore.
+// If there are any errors while reading the ledger then non-nil error is
+// returned.
+func VerifyLedger(path string, publicKey ed25519.PublicKey, checkpoint *LedgerCheckpoint) ([]LedgerProblem, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	entries, err := readLedger(path)
+	if err != nil {
+		return nil, fmt.Errorf("read ledger: %w", err)
+	}
+
+	hashes := make(map[uint64]string, len(entries))
+	for _, entry := range entries {
+		if _, ok := hashes[entry.Sequence]; !ok {
+			hashes[entry.Sequence] = hex.EncodeToString(entry.Hash())
+		}
+	}
+
+	var problems []LedgerProblem
+	var maxSeq uint64
+	seen := make(map[uint64]bool, len(entries))
+	for _, entry := range entries {
+		problem := func(kind LedgerProblemKind) {
+			problems = append(problems, LedgerProblem{Kind: kind, Sequence: entry.Sequence, Name: entry.Name})
+		}
+		if sig, err := hex.DecodeString(entry.Signature); err != nil || !ed25519.Verify(publicKey, entry.Hash(), sig) {
+			problem(LedgerInvalidSignature)
+		}
+		if entry.Sequence <= maxSeq || seen[entry.Sequence] {
+			problem(LedgerReordered)
+		}
+		seen[entry.Sequence] = true
+		if entry.Sequence > maxSeq {
+			maxSeq = entry.Sequence
+		}
+		if entry.Sequence == 1 && len(entry.Prev) != 0 {
+			problem(LedgerBrokenChain)
+		} else if prev, ok := hashes[entry.Sequence-1]; ok && entry.Prev != prev {
+			problem(LedgerBrokenChain)
+		}
+
+		digest, _, size, err := fileChecksums(filepath.Join(filepath.Dir(path), entry.Name))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			problem(LedgerMissing)
+		case err != nil:
+			return nil, fmt.Errorf("digest %s: %w", entry.Name, err)
+		case digest != entry.Digest || size != entry.Size:
+			problem(LedgerModified)
+		}
+	}
+	for seq := uint64(1); seq <= maxSeq; seq++ {
+		if !seen[seq] {
+			problems = append(problems, LedgerProblem{Kind: LedgerGap, Sequence: seq})
+		}
+	}
+	if checkpoint != nil {
+		hash, ok := hashes[checkpoint.Sequence]
+		switch {
+		case !ok:
+			problems = append(problems, LedgerProblem{Kind: LedgerTruncated, Sequence: checkpoint.Sequence})
+		case hash != checkpoint.Hash:
+			problems = append(problems, LedgerProblem{Kind: LedgerCheckpointMismatch, Sequence: checkpoint.Sequence})
+		}
+	}
+	return problems, nil
+}
+
+// ledgerName returns the name of the archive at the given path, relative to
+// the directory of the ledger.
+func ledgerName(ledger, path string) (string, error) {
+	absLedger, err := filepath.Abs(ledger)
+	if err != nil {
+		return "", fmt.Errorf("determine ledger absolute path: %w", err)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("determine file absolute path: %w", err)
+	}
+	name, err := filepath.Rel(filepath.Dir(absLedger), absPath)
+	if err != nil {
+		return "", fmt.Errorf("determine file path relative to ledger: %w", err)
+	}
+	return filepath.ToSlash(name), nil
+}
+
+// readLedger reads the entries of the ledger at the given path.
+func readLedger(path string) ([]LedgerEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("os open: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var entries []LedgerEntry
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) != 0 {
+			var entry LedgerEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return nil, fmt.Errorf("malformed line %d: %w", line, err)
+			}
+			entries = append(entries, entry)
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read: %w", err)
+		}
+	}
+}
+
+// appendLedger appends the entry to the ledger at the given path.
+func appendLedger(path string, entry LedgerEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("json marshal: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("os open: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("write entry: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("sync: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package barrelfile
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestLedger(t *testing.T) {
+	t.Parallel()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(bytes.NewReader(bytes.Repeat([]byte{7}, 64)))
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	// setupLedger creates the given archives in a new directory, and records
+	// them in order in the ledger of the directory.
+	setupLedger := func(t *testing.T, archives ...string) (string, string) {
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+
+		clk := clock{}
+		clk.Set(testTime)
+		transformer := LedgerTransformer{PrivateKey: privateKey, NowFunc: clk.Now}
+		for _, archive := range archives {
+			NewFiles(t, dir, "content of "+archive, archive)
+			path, err := transformer.Transform(filepath.Join(dir, archive))
+			r.NoErr(err)                               // should not be any error
+			r.Equal(path, filepath.Join(dir, archive)) // path should be unchanged
+		}
+		return dir, filepath.Join(dir, DefaultLedgerName)
+	}
+
+	// ledgerLines returns the lines of the ledger.
+	ledgerLines := func(t *testing.T, ledger string) []string {
+		r := is.New(t)
+
+		data, err := ioutil.ReadFile(ledger)
+		r.NoErr(err) // should not be any error
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+
+	// writeLines writes the lines to the ledger.
+	writeLines := func(t *testing.T, ledger string, lines ...string) {
+		r := is.New(t)
+
+		err := ioutil.WriteFile(ledger, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+		r.NoErr(err) // should not be any error
+	}
+
+	t.Run("invalid private key", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		file := NewFile(t, dir, "ledger-transformer-*")
+
+		path, err := LedgerTransformer{}.Transform(file)
+		r.True(err != nil)   // should be non nil
+		r.True(path == file) // path returned should be same as given path
+	})
+
+	t.Run("intact ledger", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, ledger := setupLedger(t, "application.log.3", "application.log.2", "application.log.1")
+
+		entries, err := readLedger(ledger)
+		r.NoErr(err)             // should not be any error
+		r.Equal(len(entries), 3) // entry should be recorded for every archive
+		r.Equal(entries[2].Sequence, uint64(3))
+		r.Equal(entries[2].Name, "application.log.1")
+		r.Equal(entries[0].Prev, "") // first entry should not be chained
+
+		problems, err := VerifyLedger(ledger, publicKey, nil)
+		r.NoErr(err)              // should not be any error
+		r.Equal(len(problems), 0) // intact ledger should have no problems
+	})
+
+	t.Run("wrong public key", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, ledger := setupLedger(t, "application.log.1")
+
+		otherKey, _, err := ed25519.GenerateKey(bytes.NewReader(bytes.Repeat([]byte{8}, 64)))
+		r.NoErr(err) // should not be any error
+
+		problems, err := VerifyLedger(ledger, otherKey, nil)
+		r.NoErr(err) // should not be any error
+		r.Equal(problems, []LedgerProblem{{Kind: LedgerInvalidSignature, Sequence: 1, Name: "application.log.1"}})
+	})
+
+	t.Run("modified and removed archives", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir, ledger := setupLedger(t, "application.log.3", "application.log.2", "application.log.1")
+
+		err := ioutil.WriteFile(filepath.Join(dir, "application.log.2"), []byte("altered"), 0644)
+		r.NoErr(err) // should not be any error
+		err = os.Remove(filepath.Join(dir, "application.log.3"))
+		r.NoErr(err) // should not be any error
+
+		problems, err := VerifyLedger(ledger, publicKey, nil)
+		r.NoErr(err) // should not be any error
+		r.Equal(problems, []LedgerProblem{
+			{Kind: LedgerMissing, Sequence: 1, Name: "application.log.3"},
+			{Kind: LedgerModified, Sequence: 2, Name: "application.log.2"},
+		})
+	})
+
+	t.Run("removed entry", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, ledger := setupLedger(t, "application.log.3", "application.log.2", "application.log.1")
+
+		lines := ledgerLines(t, ledger)
+		writeLines(t, ledger, lines[0], lines[2])
+
+		problems, err := VerifyLedger(ledger, publicKey, nil)
+		r.NoErr(err) // should not be any error
+		r.Equal(problems, []LedgerProblem{{Kind: LedgerGap, Sequence: 2}})
+	})
+
+	t.Run("truncated ledger", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir, ledger := setupLedger(t, "application.log.3", "application.log.2", "application.log.1")
+
+		checkpoint, err := ReadLedgerCheckpoint(ledger)
+		r.NoErr(err)                            // should not be any error
+		r.Equal(checkpoint.Sequence, uint64(3)) // checkpoint should be of the last entry
+
+		// last entry and its archive are cut off
+		lines := ledgerLines(t, ledger)
+		writeLines(t, ledger, lines[:2]...)
+		err = os.Remove(filepath.Join(dir, "application.log.1"))
+		r.NoErr(err) // should not be any error
+
+		problems, err := VerifyLedger(ledger, publicKey, nil)
+		r.NoErr(err)              // should not be any error
+		r.Equal(len(problems), 0) // truncation should not be detected without checkpoint
+
+		problems, err = VerifyLedger(ledger, publicKey, &checkpoint)
+		r.NoErr(err) // should not be any error
+		r.Equal(problems, []LedgerProblem{{Kind: LedgerTruncated, Sequence: 3}})
+	})
+
+	t.Run("checkpoint of replaced entry", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, ledger := setupLedger(t, "application.log.2", "application.log.1")
+
+		var checkpoints []LedgerCheckpoint
+		transformer := LedgerTransformer{
+			Ledger:     ledger,
+			PrivateKey: privateKey,
+			Checkpoint: func(checkpoint LedgerCheckpoint) error {
+				checkpoints = append(checkpoints, checkpoint)
+				return nil
+			},
+		}
+		dir := filepath.Dir(ledger)
+		NewFiles(t, dir, "original", "application.log.0")
+		_, err := transformer.Transform(filepath.Join(dir, "application.log.0"))
+		r.NoErr(err)                 // should not be any error
+		r.Equal(len(checkpoints), 1) // checkpoint should be kept for the entry
+		r.Equal(checkpoints[0].Sequence, uint64(3))
+
+		// last entry is replaced by a validly signed entry of another archive
+		lines := ledgerLines(t, ledger)
+		writeLines(t, ledger, lines[:2]...)
+		NewFiles(t, dir, "replaced", "application.log.0")
+		_, err = LedgerTransformer{Ledger: ledger, PrivateKey: privateKey}.Transform(filepath.Join(dir, "application.log.0"))
+		r.NoErr(err) // should not be any error
+
+		problems, err := VerifyLedger(ledger, publicKey, &checkpoints[0])
+		r.NoErr(err) // should not be any error
+		r.Equal(problems, []LedgerProblem{{Kind: LedgerCheckpointMismatch, Sequence: 3}})
+	})
+
+	t.Run("reordered entries", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, ledger := setupLedger(t, "application.log.3", "application.log.2", "application.log.1")
+
+		lines := ledgerLines(t, ledger)
+		writeLines(t, ledger, lines[0], lines[2], lines[1])
+
+		problems, err := VerifyLedger(ledger, publicKey, nil)
+		r.NoErr(err) // should not be any error
+		r.Equal(problems, []LedgerProblem{{Kind: LedgerReordered, Sequence: 2, Name: "application.log.2"}})
+	})
+
+	t.Run("modified entry", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, ledger := setupLedger(t, "application.log.2", "application.log.1")
+
+		lines := ledgerLines(t, ledger)
+		writeLines(t, ledger, strings.Replace(lines[0], `"size":28`, `"size":29`, 1), lines[1])
+
+		problems, err := VerifyLedger(ledger, publicKey, nil)
+		r.NoErr(err) // should not be any error
+		r.Equal(problems, []LedgerProblem{
+			{Kind: LedgerInvalidSignature, Sequence: 1, Name: "application.log.2"},
+			{Kind: LedgerModified, Sequence: 1, Name: "application.log.2"},
+			{Kind: LedgerBrokenChain, Sequence: 2, Name: "application.log.1"},
+		})
+	})
+
+	t.Run("malformed ledger", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, ledger := setupLedger(t, "application.log.1")
+		writeLines(t, ledger, "not an entry")
+
+		_, err := VerifyLedger(ledger, publicKey, nil)
+		r.True(err != nil) // should be non nil
+	})
+}
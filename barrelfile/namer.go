@@ -2,12 +2,15 @@ package barrelfile
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // TimestampSequenceNamer generates name on the basis of mtime timestamp of the
@@ -16,6 +19,23 @@ import (
 type TimestampSequenceNamer struct {
 	// Format used to format the mtime of the file.
 	TimestampFormat string
+
+	// TimeSource determines the timestamp used instead of the mtime of the
+	// file, eg. RotationTime or FirstRecordTime.
+	TimeSource TimeSource
+
+	// EndTimeSource, if set, determines the timestamp of the end of the window
+	// covered by the file. Then the name contains a range of timestamps, eg.
+	// application_2021-01-02T10:00--11:00.0.log.
+	EndTimeSource TimeSource
+
+	// EndTimestampFormat used to format the end of the window. If unset, it
+	// will correspond to the TimestampFormat.
+	EndTimestampFormat string
+
+	// RangeSeparator separates the timestamps of the range. If unset, it will
+	// correspond to "--".
+	RangeSeparator string
 }
 
 // Name generates a new timestamp and index suffixed name for file at current
@@ -57,7 +77,10 @@ func (n TimestampSequenceNamer) Name(current string) (string, error) {
 		tsFormat = "2006-01-02"
 	}
 
-	ts := stat.ModTime().Format(tsFormat)
+	ts, err := n.timestamp(current, stat.ModTime(), tsFormat)
+	if err != nil {
+		return current, fmt.Errorf("get timestamp: %w", err)
+	}
 
 	newName := fmt.Sprintf("%s_%s%s", baseName, ts, fullExt)
 	newPath := filepath.Join(dir, newName)
@@ -72,6 +95,36 @@ func (n TimestampSequenceNamer) Name(current string) (string, error) {
 	return seqNewPath, nil
 }
 
+func (n TimestampSequenceNamer) timestamp(current string, modTime time.Time, tsFormat string) (string, error) {
+	start := modTime
+	if n.TimeSource != nil {
+		t, err := n.TimeSource(current)
+		if err != nil {
+			return "", fmt.Errorf("time source: %w", err)
+		}
+		start = t
+	}
+	if n.EndTimeSource == nil {
+		return start.Format(tsFormat), nil
+	}
+	end, err := n.EndTimeSource(current)
+	if err != nil {
+		return "", fmt.Errorf("end time source: %w", err)
+	}
+	endFormat := n.EndTimestampFormat
+	if len(endFormat) == 0 {
+		endFormat = tsFormat
+	}
+	return start.Format(tsFormat) + n.rangeSeparator() + end.Format(endFormat), nil
+}
+
+func (n TimestampSequenceNamer) rangeSeparator() string {
+	if len(n.RangeSeparator) == 0 {
+		return "--"
+	}
+	return n.RangeSeparator
+}
+
 func (n TimestampSequenceNamer) maxIdxInDir(path string) (int, error) {
 	dir := filepath.Dir(path)
 	base := filepath.Base(path)
@@ -112,6 +165,970 @@ func (n TimestampSequenceNamer) indexPath(path string, index int) string {
 	return filepath.Join(dir, newBase)
 }
 
+// TimeSource determines a time of the file at the given path, used for naming
+// the file.
+type TimeSource func(path string) (time.Time, error)
+
+// ModTime is a TimeSource returning the mtime of the file, ie. the time of the
+// last write.
+func ModTime(path string) (time.Time, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("os stat: %w", err)
+	}
+	return stat.ModTime(), nil
+}
+
+// RotationTime returns a TimeSource returning the time of the rotation, as
+// given by the provided nowFunc. If nowFunc is nil, time.Now is used.
+func RotationTime(nowFunc func() time.Time) TimeSource {
+	if nowFunc == nil {
+		nowFunc = time.Now
+	}
+	return func(_ string) (time.Time, error) {
+		return nowFunc(), nil
+	}
+}
+
+// CreationTime is a TimeSource returning the time the file was created, ie.
+// opened for the first time. The birth time reported by the file system is
+// used, and where it is not available the time persisted by AgeBasedTrigger
+// with default StatePath.
+func CreationTime(path string) (time.Time, error) {
+	if t, err := fileBirthTime(path); err == nil {
+		return t, nil
+	}
+	t, err := (&AgeBasedTrigger{}).readState(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("birth time not available: %w", err)
+	}
+	return t, nil
+}
+
+// FirstRecordTime returns a TimeSource returning the timestamp of the first
+// record of the file, parsed using the given layout. See RecordTime for how
+// records are parsed. If no record has a timestamp, eg. the file is empty, the
+// mtime of the file is returned, so that the file can still be rotated.
+func FirstRecordTime(layout string) TimeSource {
+	return func(path string) (time.Time, error) {
+		return fileRecordTime(path, layout, false)
+	}
+}
+
+// LastRecordTime returns a TimeSource returning the timestamp of the last
+// record of the file, parsed using the given layout. See RecordTime for how
+// records are parsed. If no record has a timestamp, the mtime of the file is
+// returned, as with FirstRecordTime.
+func LastRecordTime(layout string) TimeSource {
+	return func(path string) (time.Time, error) {
+		return fileRecordTime(path, layout, true)
+	}
+}
+
+// RecordTime parses the timestamp at the start of the given newline delimited
+// record using the given time layout. The timestamp is taken as the leading
+// space separated fields of the record, as many as in the layout, optionally
+// enclosed in square brackets. Timestamps without zone are parsed in local
+// time.
+//
+//     layout = 2006-01-02 15:04:05, record = [2021-01-02 10:00:00] started
+//
+// If the record does not start with a timestamp then false is returned.
+func RecordTime(record []byte, layout string) (time.Time, bool) {
+	fields := strings.Count(layout, " ") + 1
+	line := strings.TrimLeft(string(record), "[")
+	end := 0
+	for i := 0; i < fields; i++ {
+		next := strings.IndexByte(line[end:], ' ')
+		if next == -1 {
+			end = len(line)
+			break
+		}
+		end += next
+		if i+1 < fields {
+			end++
+		}
+	}
+	value := strings.TrimRight(line[:end], "]\r\n")
+	t, err := time.ParseInLocation(layout, value, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// maxRecordScan is the max number of bytes scanned for a record with a
+// timestamp, from the start or from the end of the file.
+const maxRecordScan = 4 << 20
+
+// fileRecordTime returns the timestamp of the first, or the last, record of
+// the file at given path which starts with a timestamp, or the mtime of the
+// file if there is no such record.
+func fileRecordTime(path, layout string, last bool) (time.Time, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("os open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("stat file: %w", err)
+	}
+	size := stat.Size()
+	scan := size
+	if scan > maxRecordScan {
+		scan = maxRecordScan
+	}
+	offset := int64(0)
+	if last {
+		offset = size - scan
+	}
+	buf := make([]byte, scan)
+	if _, err := file.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return time.Time{}, fmt.Errorf("read file: %w", err)
+	}
+
+	records := strings.Split(string(buf), "\n")
+	if last {
+		for i := len(records) - 1; i >= 0; i-- {
+			if t, ok := RecordTime([]byte(records[i]), layout); ok {
+				return t, nil
+			}
+		}
+	} else {
+		for _, record := range records {
+			if t, ok := RecordTime([]byte(record), layout); ok {
+				return t, nil
+			}
+		}
+	}
+	return stat.ModTime(), nil
+}
+
+var _ Parser = (*TimestampSequenceNamer)(nil)
+
+// Parse parses the path generated by Name back into an Archive, any suffixes
+// added after the extension (eg. ".gz") are parsed as Archive.Suffix. For
+// names with a range of timestamps, the start of the range is parsed.
+//
+//     path = application_2021-01-02.3.log.gz
+//     out  = {Base: application, Ext: .log, Suffix: .gz, Sequence: 3, ...}
+//
+// If the path is not generated by Name, then an error wrapping ErrNotArchive
+// is returned.
+func (n TimestampSequenceNamer) Parse(path string) (Archive, error) {
+	tsFormat := n.TimestampFormat
+	if len(tsFormat) == 0 {
+		tsFormat = "2006-01-02"
+	}
+
+	name := filepath.Base(path)
+	for u := strings.LastIndexByte(name, '_'); u > 0; u = strings.LastIndexByte(name[:u], '_') {
+		rest := name[u+1:]
+		for j := strings.IndexByte(rest, '.'); j != -1; j = nextIndexByte(rest, '.', j) {
+			seqEnd := j + 1
+			for seqEnd < len(rest) && rest[seqEnd] >= '0' && rest[seqEnd] <= '9' {
+				seqEnd++
+			}
+			if seqEnd == j+1 || (seqEnd < len(rest) && rest[seqEnd] != '.') {
+				continue
+			}
+			tsStr := rest[:j]
+			if n.EndTimeSource != nil {
+				sep := strings.Index(tsStr, n.rangeSeparator())
+				if sep == -1 {
+					continue
+				}
+				tsStr = tsStr[:sep]
+			}
+			ts, err := time.ParseInLocation(tsFormat, tsStr, time.Local)
+			if err != nil {
+				continue
+			}
+			seq, err := strconv.Atoi(rest[j+1 : seqEnd])
+			if err != nil {
+				continue
+			}
+			ext, suffix := splitSuffix(rest[seqEnd:])
+			return Archive{
+				Path:      path,
+				Base:      name[:u],
+				Ext:       ext,
+				Suffix:    suffix,
+				Timestamp: ts,
+				Sequence:  seq,
+			}, nil
+		}
+	}
+	return Archive{}, fmt.Errorf("parse %s: %w", name, ErrNotArchive)
+}
+
+// nextIndexByte returns the index of the next instance of c in s after the
+// index i, or -1 if c is not present after i.
+func nextIndexByte(s string, c byte, i int) int {
+	j := strings.IndexByte(s[i+1:], c)
+	if j == -1 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+// ShiftingNamer generates logrotate style names, where the newest archive of
+// the file is always suffixed with index 1, and older archives are shifted to
+// the next index.
+type ShiftingNamer struct {
+	// MaxArchives is the max length of the chain of archives. Archives shifted
+	// beyond it are removed. If unset (ie. 0), chain length is not limited.
+	MaxArchives int
+}
+
+// Name shifts the existing archives of the file at current path, and returns
+// the path suffixed with index 1.
+//
+//     dir
+//      |- application.log.1
+//      |- application.log.2.gz
+//
+//     current = application.log, out = application.log.1
+//
+//     dir
+//      |- application.log.2
+//      |- application.log.3.gz
+//
+// Archives are renamed starting from the highest index, and keep any suffix
+// following the index (eg. ".gz"). Only the contiguous chain starting at index
+// 1 is shifted, archives after a gap in the chain are kept as they are, unless
+// they exceed MaxArchives.
+//
+// If there are any, errors while reading the directory, or renaming or
+// removing the archives, then non-nil error is returned.
+func (n ShiftingNamer) Name(current string) (string, error) {
+	dir := filepath.Dir(current)
+	base := filepath.Base(current)
+
+	members, err := n.members(dir, base)
+	if err != nil {
+		return current, fmt.Errorf("get archives in directory: %w", err)
+	}
+
+	var idxs []int
+	for idx := range members {
+		idxs = append(idxs, idx)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(idxs)))
+
+	chain := 0
+	for members[chain+1] != nil {
+		chain++
+	}
+
+	for _, idx := range idxs {
+		shift := idx <= chain
+		for _, suffix := range members[idx] {
+			path := filepath.Join(dir, fmt.Sprintf("%s.%d%s", base, idx, suffix))
+			if n.MaxArchives > 0 && ((shift && idx >= n.MaxArchives) || idx > n.MaxArchives) {
+				if err := os.Remove(path); err != nil {
+					return current, fmt.Errorf("os remove archive: %w", err)
+				}
+				continue
+			}
+			if !shift {
+				continue
+			}
+			newPath := filepath.Join(dir, fmt.Sprintf("%s.%d%s", base, idx+1, suffix))
+			if err := os.Rename(path, newPath); err != nil {
+				return current, fmt.Errorf("os rename archive: %w", err)
+			}
+		}
+	}
+	return fmt.Sprintf("%s.1", current), nil
+}
+
+var _ Parser = (*ShiftingNamer)(nil)
+
+var shiftingNameRe = regexp.MustCompile(`^(?P<name>.+)\.(?P<index>\d+)(?P<suffix>(?:\.[^.\d][^.]*)*)$`)
+
+// Parse parses the path generated by Name, and shifted later on, back into an
+// Archive. Shifted archives do not encode a timestamp.
+//
+//     path = application.log.3.gz
+//     out  = {Base: application, Ext: .log, Suffix: .gz, Sequence: 3}
+//
+// If the path is not generated by Name, then an error wrapping ErrNotArchive
+// is returned.
+func (n ShiftingNamer) Parse(path string) (Archive, error) {
+	name := filepath.Base(path)
+	match := shiftingNameRe.FindStringSubmatch(name)
+	if match == nil {
+		return Archive{}, fmt.Errorf("parse %s: %w", name, ErrNotArchive)
+	}
+	seq, err := strconv.Atoi(match[2])
+	if err != nil || seq == 0 {
+		return Archive{}, fmt.Errorf("parse %s: %w", name, ErrNotArchive)
+	}
+	ext := filepathFullExt(match[1])
+	return Archive{
+		Path:     path,
+		Base:     strings.Replace(match[1], ext, "", 1),
+		Ext:      ext,
+		Suffix:   match[3],
+		Sequence: seq,
+	}, nil
+}
+
+// sortArchives sorts the archives from the highest index to the lowest, ie.
+// from the oldest to the newest.
+func (n ShiftingNamer) sortArchives(archives []Archive) {
+	sort.SliceStable(archives, func(i, j int) bool {
+		return archives[i].Sequence > archives[j].Sequence
+	})
+}
+
+// members returns the suffixes of archives of base in dir by index.
+func (n ShiftingNamer) members(dir, base string) (map[int][]string, error) {
+	re, err := regexp.Compile(fmt.Sprintf(`^%s\.(?P<index>\d+)(?P<suffix>\..+)?$`, regexp.QuoteMeta(base)))
+	if err != nil {
+		return nil, fmt.Errorf("regexp compile: %w", err)
+	}
+
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil read dir: %w", err)
+	}
+
+	members := make(map[int][]string)
+	for _, fileInfo := range fileInfos {
+		match := re.FindStringSubmatch(fileInfo.Name())
+		if match == nil {
+			continue
+		}
+		idx, err := strconv.Atoi(match[1])
+		if err != nil || idx == 0 {
+			continue
+		}
+		members[idx] = append(members[idx], match[2])
+	}
+	return members, nil
+}
+
+// PartitionNamer generates name on the basis of mtime timestamp of the file,
+// like TimestampSequenceNamer, but places the file in nested directories
+// partitioned by the mtime, eg. 2021/01/02/ or dt=2021-01-02/. Sequence index
+// is computed only within the partition.
+type PartitionNamer struct {
+	// Root directory of the partitions. If unset, it will correspond to the
+	// directory of the file.
+	Root string
+
+	// PartitionLayout used to format the mtime of the file as the partition
+	// directory, slashes separate the nested directories. If unset, it will
+	// correspond to "2006/01/02".
+	PartitionLayout string
+
+	// Format used to format the mtime of the file in the name. If unset, it
+	// will correspond to "2006-01-02".
+	TimestampFormat string
+
+	// DirMode is used to create partition directories. If unset, it will
+	// correspond to 0755.
+	DirMode os.FileMode
+}
+
+// Name generates a new timestamp and index suffixed name for file at current
+// path, inside the partition directory for the mtime of the file.
+//
+//     current = application.log, out = 2021/01/02/application_2021-01-02.0.log
+//
+// The partition directory is created if it does not exist. If it already has
+// files with same name and suffixed timestamp with indexes, then it returns
+// the name with next available index.
+//
+// If there are any, errors while checking file stat, reading or creating the
+// directories, then non-nil error is returned.
+func (n PartitionNamer) Name(current string) (string, error) {
+	stat, err := os.Stat(current)
+	if err != nil && os.IsNotExist(err) {
+		return current, fmt.Errorf("no such file: %w", err)
+	}
+	if err != nil {
+		return current, fmt.Errorf("os stat: %w", err)
+	}
+	if stat.IsDir() {
+		return current, fmt.Errorf("path is of a directory not a file")
+	}
+
+	root := n.Root
+	if len(root) == 0 {
+		root = filepath.Dir(current)
+	}
+	layout := n.PartitionLayout
+	if len(layout) == 0 {
+		layout = "2006/01/02"
+	}
+	tsFormat := n.TimestampFormat
+	if len(tsFormat) == 0 {
+		tsFormat = "2006-01-02"
+	}
+	dirMode := n.DirMode
+	if dirMode == 0 {
+		dirMode = 0755
+	}
+
+	modTime := stat.ModTime()
+	dir := filepath.Join(root, filepath.FromSlash(modTime.Format(layout)))
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return current, fmt.Errorf("os mkdir all: %w", err)
+	}
+
+	base := filepath.Base(current)
+	fullExt := filepathFullExt(base)
+	baseName := strings.Replace(base, fullExt, "", 1)
+	prefix := fmt.Sprintf("%s_%s.", baseName, modTime.Format(tsFormat))
+
+	maxIdx, err := maxSeqInDir(dir, prefix, fullExt)
+	if err != nil {
+		return current, fmt.Errorf("get max sequence in directory: %w", err)
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s%d%s", prefix, maxIdx+1, fullExt)), nil
+}
+
+var _ Parser = (*PartitionNamer)(nil)
+
+// Parse parses the path generated by Name back into an Archive, in the same
+// way as TimestampSequenceNamer.Parse.
+//
+// If the path is not generated by Name, then an error wrapping ErrNotArchive
+// is returned.
+func (n PartitionNamer) Parse(path string) (Archive, error) {
+	return TimestampSequenceNamer{TimestampFormat: n.TimestampFormat}.Parse(path)
+}
+
+// TemplateNamer generates name on the basis of a pattern, which can refer to
+// properties of the file and of the rotation. The following placeholders are
+// supported:
+//
+//     {dir}            directory of the file
+//     {name}           name of the file, eg. application.log
+//     {base}           name of the file without extension, eg. application
+//     {ext}            extension of the file, eg. .log
+//     {host}           hostname of the machine
+//     {pid}            process id
+//     {seq}            sequence index, starting from 0, of the name
+//     {reason}         reason of the rotation as given by ReasonFunc
+//     {mtime:<fmt>}    mtime of the file formatted with strftime format
+//     %<c>             rotation time formatted with strftime directive
+//
+// Supported strftime directives are %Y, %y, %m, %d, %H, %M, %S, %j, %b, %a,
+// %z, %Z, %s, %F, %T and %% for a literal percent sign.
+//
+// Patterns which do not evaluate to an absolute path are relative to the
+// directory of the file. For example
+//
+//     {dir}/archive/{base}-{host}-{pid}-%Y%m%dT%H%M.{seq}{ext}
+//
+// Use NewTemplateNamer to create a TemplateNamer.
+type TemplateNamer struct {
+	// NowFunc to wrap stdlib time.Now for testing.
+	NowFunc func() time.Time
+
+	// ReasonFunc returns the reason of the rotation, used for {reason}
+	// placeholder. If unset, it will correspond to "rotate".
+	ReasonFunc func() string
+
+	// DirMode is used to create directories of the new name. If unset, it
+	// will correspond to 0755.
+	DirMode os.FileMode
+
+	pattern string
+	tokens  []templateToken
+	parseRe *regexp.Regexp
+}
+
+type templateToken struct {
+	// kind of the token, one of "literal", "field", "mtime" or "now".
+	kind string
+	// value of the token, literal text, field name or strftime format.
+	value string
+}
+
+// seqMarker marks the position of the sequence index while rendering the
+// template.
+const seqMarker = "\x00"
+
+// NewTemplateNamer parses the given pattern and returns a TemplateNamer for it.
+//
+// If the pattern contains unknown placeholders or strftime directives, or if
+// {seq} placeholder is used more than once or outside the last element of the
+// path, then non-nil error is returned.
+func NewTemplateNamer(pattern string) (*TemplateNamer, error) {
+	tokens, err := parseTemplate(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	parseRe, err := templateRegexp(pattern, tokens)
+	if err != nil {
+		return nil, fmt.Errorf("template regexp: %w", err)
+	}
+	return &TemplateNamer{pattern: pattern, tokens: tokens, parseRe: parseRe}, nil
+}
+
+// Name generates a new name for the file at current path by rendering the
+// pattern. If the pattern contains {seq} then, like TimestampSequenceNamer, it
+// returns the name with next available index in the directory of the new
+// name. The directory of the new name is created if it does not exist.
+//
+// If there are any, errors while checking file stat, reading or creating the
+// directories, or if the pattern renders to a directory, eg. when all the
+// placeholders are empty, then non-nil error is returned.
+func (n *TemplateNamer) Name(current string) (string, error) {
+	stat, err := os.Stat(current)
+	if err != nil && os.IsNotExist(err) {
+		return current, fmt.Errorf("no such file: %w", err)
+	}
+	if err != nil {
+		return current, fmt.Errorf("os stat: %w", err)
+	}
+	if stat.IsDir() {
+		return current, fmt.Errorf("path is of a directory not a file")
+	}
+
+	var nowTime time.Time
+	if n.NowFunc != nil {
+		nowTime = n.NowFunc()
+	} else {
+		nowTime = time.Now()
+	}
+
+	rendered, err := n.render(current, stat.ModTime(), nowTime)
+	if err != nil {
+		return current, fmt.Errorf("render template: %w", err)
+	}
+	if len(rendered) == 0 || os.IsPathSeparator(rendered[len(rendered)-1]) {
+		return current, fmt.Errorf("template renders to a directory not a file")
+	}
+	if !filepath.IsAbs(rendered) {
+		rendered = filepath.Join(filepath.Dir(current), rendered)
+	}
+	if stat, err := os.Stat(rendered); err == nil && stat.IsDir() {
+		return current, fmt.Errorf("template renders to a directory not a file")
+	}
+
+	dir := filepath.Dir(rendered)
+	dirMode := n.DirMode
+	if dirMode == 0 {
+		dirMode = 0755
+	}
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return current, fmt.Errorf("os mkdir all: %w", err)
+	}
+
+	base := filepath.Base(rendered)
+	if !strings.Contains(base, seqMarker) {
+		return rendered, nil
+	}
+	parts := strings.SplitN(base, seqMarker, 2)
+	maxIdx, err := maxSeqInDir(dir, parts[0], parts[1])
+	if err != nil {
+		return current, fmt.Errorf("get max sequence in directory: %w", err)
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s%d%s", parts[0], maxIdx+1, parts[1])), nil
+}
+
+func (n *TemplateNamer) render(current string, modTime, nowTime time.Time) (string, error) {
+	name := filepath.Base(current)
+	ext := filepathFullExt(name)
+
+	var sb strings.Builder
+	for _, token := range n.tokens {
+		switch token.kind {
+		case "literal":
+			sb.WriteString(token.value)
+		case "now":
+			sb.WriteString(strftime(nowTime, token.value))
+		case "mtime":
+			sb.WriteString(strftime(modTime, token.value))
+		case "field":
+			switch token.value {
+			case "dir":
+				sb.WriteString(filepath.Dir(current))
+			case "name":
+				sb.WriteString(name)
+			case "base":
+				sb.WriteString(strings.Replace(name, ext, "", 1))
+			case "ext":
+				sb.WriteString(ext)
+			case "host":
+				host, err := os.Hostname()
+				if err != nil {
+					return "", fmt.Errorf("os hostname: %w", err)
+				}
+				sb.WriteString(host)
+			case "pid":
+				sb.WriteString(strconv.Itoa(os.Getpid()))
+			case "seq":
+				sb.WriteString(seqMarker)
+			case "reason":
+				reason := "rotate"
+				if n.ReasonFunc != nil {
+					reason = n.ReasonFunc()
+				}
+				sb.WriteString(reason)
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+var _ Parser = (*TemplateNamer)(nil)
+
+// Parse parses the path generated by Name back into an Archive. Base and Ext
+// are parsed from {name}, {base} and {ext} placeholders, Sequence from {seq}
+// and Timestamp from the rotation time, or from {mtime:<fmt>} when the pattern
+// does not contain the rotation time.
+//
+// If the path is not generated by Name, then an error wrapping ErrNotArchive
+// is returned. If the TemplateNamer is not created with NewTemplateNamer, then
+// non-nil error is returned.
+func (n *TemplateNamer) Parse(path string) (Archive, error) {
+	if n.parseRe == nil {
+		return Archive{}, fmt.Errorf("template namer not created with NewTemplateNamer")
+	}
+	match := n.parseRe.FindStringSubmatch(filepath.ToSlash(path))
+	if match == nil {
+		return Archive{}, fmt.Errorf("parse %s: %w", filepath.Base(path), ErrNotArchive)
+	}
+
+	archive := Archive{Path: path}
+	var nowValues, nowFormats, mtimeValues, mtimeFormats []string
+	var ext string
+	for i, group := range n.parseRe.SubexpNames() {
+		value := match[i]
+		switch {
+		case group == "name":
+			ext = filepathFullExt(value)
+			archive.Base = strings.Replace(value, ext, "", 1)
+		case group == "base":
+			archive.Base = value
+		case group == "ext":
+			ext = value
+		case group == "suffix":
+			ext += value
+		case group == "seq":
+			seq, err := strconv.Atoi(value)
+			if err != nil {
+				return Archive{}, fmt.Errorf("parse %s: %w", filepath.Base(path), ErrNotArchive)
+			}
+			archive.Sequence = seq
+		case strings.HasPrefix(group, "now"):
+			nowValues = append(nowValues, value)
+			nowFormats = append(nowFormats, n.tokens[tokenIndex(group)].value)
+		case strings.HasPrefix(group, "mtime"):
+			mtimeValues = append(mtimeValues, value)
+			mtimeFormats = append(mtimeFormats, n.tokens[tokenIndex(group)].value)
+		}
+	}
+	archive.Ext, archive.Suffix = splitSuffix(ext)
+
+	values, formats := nowValues, nowFormats
+	if len(values) == 0 {
+		values, formats = mtimeValues, mtimeFormats
+	}
+	if len(values) != 0 {
+		ts, err := parseStrftime(values, formats)
+		if err != nil {
+			return Archive{}, fmt.Errorf("parse %s: %v: %w", filepath.Base(path), err, ErrNotArchive)
+		}
+		archive.Timestamp = ts
+	}
+	return archive, nil
+}
+
+// tokenIndex returns the index of the token from the name of its capture
+// group, eg. now3.
+func tokenIndex(group string) int {
+	idx, _ := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(group, "now"), "mtime"))
+	return idx
+}
+
+// templateRegexp returns the regular expression matching paths generated by
+// the template, with a capture group for each placeholder used while parsing.
+func templateRegexp(pattern string, tokens []templateToken) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	if strings.HasPrefix(pattern, "{dir}") || filepath.IsAbs(pattern) {
+		sb.WriteString("^")
+	} else {
+		sb.WriteString("(?:^|/)")
+	}
+	for i, token := range tokens {
+		switch token.kind {
+		case "literal":
+			sb.WriteString(regexp.QuoteMeta(filepath.ToSlash(token.value)))
+		case "now", "mtime":
+			sb.WriteString(fmt.Sprintf("(?P<%s%d>%s)", token.kind, i, strftimePattern(token.value)))
+		case "field":
+			switch token.value {
+			case "dir":
+				sb.WriteString(`.*`)
+			case "name":
+				sb.WriteString(`(?P<name>[^/]+?)`)
+			case "base":
+				sb.WriteString(`(?P<base>[^/]+?)`)
+			case "ext":
+				sb.WriteString(`(?P<ext>(?:\.[^./]+)*?)`)
+			case "pid":
+				sb.WriteString(`\d+`)
+			case "seq":
+				sb.WriteString(`(?P<seq>\d+)`)
+			default:
+				sb.WriteString(`[^/]+?`)
+			}
+		}
+	}
+	sb.WriteString(`(?P<suffix>(?:\.[^./]+)*)$`)
+	return regexp.Compile(sb.String())
+}
+
+// strftimePattern returns the regular expression matching the values of the
+// given strftime format. Format is expected to be validated with
+// validateStrftime.
+func strftimePattern(format string) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			sb.WriteString(regexp.QuoteMeta(string(format[i])))
+			continue
+		}
+		i++
+		if pattern, ok := strftimePatterns[format[i]]; ok {
+			sb.WriteString(pattern)
+			continue
+		}
+		sb.WriteString(regexp.QuoteMeta(string(format[i])))
+	}
+	return sb.String()
+}
+
+// parseStrftime parses the given values formatted with the corresponding
+// strftime formats into a single time.
+func parseStrftime(values, formats []string) (time.Time, error) {
+	var layouts []string
+	for i, format := range formats {
+		if format == "%s" {
+			unix, err := strconv.ParseInt(values[i], 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("parse unix time: %w", err)
+			}
+			return time.Unix(unix, 0), nil
+		}
+		var sb strings.Builder
+		for j := 0; j < len(format); j++ {
+			if format[j] != '%' || j+1 >= len(format) {
+				sb.WriteByte(format[j])
+				continue
+			}
+			j++
+			if layout, ok := strftimeLayouts[format[j]]; ok {
+				sb.WriteString(layout)
+				continue
+			}
+			sb.WriteByte(format[j])
+		}
+		layouts = append(layouts, sb.String())
+	}
+	ts, err := time.ParseInLocation(strings.Join(layouts, "\x00"), strings.Join(values, "\x00"), time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time parse: %w", err)
+	}
+	return ts, nil
+}
+
+var templateFields = map[string]bool{
+	"dir": true, "name": true, "base": true, "ext": true, "host": true,
+	"pid": true, "seq": true, "reason": true,
+}
+
+func parseTemplate(pattern string) ([]templateToken, error) {
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	var tokens []templateToken
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() != 0 {
+			tokens = append(tokens, templateToken{kind: "literal", value: literal.String()})
+			literal.Reset()
+		}
+	}
+	seqSeen := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '%':
+			if i+1 >= len(pattern) {
+				return nil, fmt.Errorf("dangling %% at end of pattern")
+			}
+			i++
+			if pattern[i] == '%' {
+				literal.WriteByte('%')
+				continue
+			}
+			if !strftimeDirective(pattern[i]) {
+				return nil, fmt.Errorf("unknown strftime directive %%%c", pattern[i])
+			}
+			flush()
+			tokens = append(tokens, templateToken{kind: "now", value: pattern[i-1 : i+1]})
+		case c == '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed placeholder at %d", i)
+			}
+			placeholder := pattern[i+1 : i+end]
+			i += end
+			flush()
+			if strings.HasPrefix(placeholder, "mtime:") {
+				format := strings.TrimPrefix(placeholder, "mtime:")
+				if err := validateStrftime(format); err != nil {
+					return nil, fmt.Errorf("placeholder {%s}: %w", placeholder, err)
+				}
+				tokens = append(tokens, templateToken{kind: "mtime", value: format})
+				continue
+			}
+			if !templateFields[placeholder] {
+				return nil, fmt.Errorf("unknown placeholder {%s}", placeholder)
+			}
+			if placeholder == "seq" {
+				if seqSeen {
+					return nil, fmt.Errorf("placeholder {seq} used more than once")
+				}
+				seqSeen = true
+			}
+			tokens = append(tokens, templateToken{kind: "field", value: placeholder})
+		case c == '}':
+			return nil, fmt.Errorf("unexpected } at %d", i)
+		default:
+			if seqSeen && (c == '/' || c == filepath.Separator) {
+				return nil, fmt.Errorf("placeholder {seq} used outside last element of path")
+			}
+			literal.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+// strftimeLayouts maps strftime directives to time layouts. %s is handled
+// separately as it has no time layout.
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'H': "15",
+	'M': "04",
+	'S': "05",
+	'j': "002",
+	'b': "Jan",
+	'a': "Mon",
+	'z': "-0700",
+	'Z': "MST",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+}
+
+// strftimePatterns maps strftime directives to regular expressions matching
+// their formatted values.
+var strftimePatterns = map[byte]string{
+	'Y': `\d{4}`,
+	'y': `\d{2}`,
+	'm': `\d{2}`,
+	'd': `\d{2}`,
+	'H': `\d{2}`,
+	'M': `\d{2}`,
+	'S': `\d{2}`,
+	'j': `\d{3}`,
+	'b': `[A-Za-z]{3}`,
+	'a': `[A-Za-z]{3}`,
+	'z': `[+-]\d{4}`,
+	'Z': `[A-Za-z0-9+-]+`,
+	's': `-?\d+`,
+	'F': `\d{4}-\d{2}-\d{2}`,
+	'T': `\d{2}:\d{2}:\d{2}`,
+}
+
+func strftimeDirective(c byte) bool {
+	_, ok := strftimePatterns[c]
+	return ok
+}
+
+func validateStrftime(format string) error {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if i+1 >= len(format) {
+			return fmt.Errorf("dangling %% at end of format")
+		}
+		i++
+		if format[i] != '%' && !strftimeDirective(format[i]) {
+			return fmt.Errorf("unknown strftime directive %%%c", format[i])
+		}
+	}
+	return nil
+}
+
+// strftime formats the given time with the given strftime format. Format is
+// expected to be validated with validateStrftime.
+func strftime(t time.Time, format string) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		if format[i] == 's' {
+			sb.WriteString(strconv.FormatInt(t.Unix(), 10))
+			continue
+		}
+		if layout, ok := strftimeLayouts[format[i]]; ok {
+			sb.WriteString(t.Format(layout))
+			continue
+		}
+		sb.WriteByte(format[i])
+	}
+	return sb.String()
+}
+
+// maxSeqInDir returns the max sequence index of files in the directory which
+// are named with the given prefix and suffix around the index, followed by any
+// extensions added by later transformers, eg. ".gz". If there are no such
+// files -1 is returned.
+func maxSeqInDir(dir, prefix, suffix string) (int, error) {
+	re, err := regexp.Compile(fmt.Sprintf(`^%s(?P<index>\d+)%s`, regexp.QuoteMeta(prefix), regexp.QuoteMeta(suffix)))
+	if err != nil {
+		return 0, fmt.Errorf("regexp compile: %w", err)
+	}
+
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("ioutil read dir: %w", err)
+	}
+
+	maxIdx := -1
+	for _, fileInfo := range fileInfos {
+		match := re.FindStringSubmatch(fileInfo.Name())
+		if match == nil {
+			continue
+		}
+		idx, _ := strconv.Atoi(match[1])
+		if idx > maxIdx {
+			maxIdx = idx
+		}
+	}
+	return maxIdx, nil
+}
+
 func filepathFullExt(path string) string {
 	firstDotIdx := -1
 	for i := len(path) - 1; i >= 0 && path[i] != filepath.Separator; i-- {
@@ -1,10 +1,13 @@
 package barrelfile
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 )
@@ -125,3 +128,652 @@ func TestTimestampSequenceNamer_Name(t *testing.T) {
 		r.True(newName == wantName)
 	})
 }
+
+func TestShiftingNamer_Name(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no archives", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+
+		namer := ShiftingNamer{}
+
+		current := filepath.Join(dir, "application.log")
+		newName, err := namer.Name(current)
+		r.NoErr(err) // should not be any error
+		r.Equal(newName, filepath.Join(dir, "application.log.1"))
+		r.Equal(DirFiles(t, dir), []string{"application.log"}) // no files should be renamed
+	})
+
+	t.Run("chain with compressed archives", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+		NewFiles(t, dir, "1", "application.log.1")
+		NewFiles(t, dir, "2", "application.log.2.gz")
+		NewFiles(t, dir, "3", "application.log.3.gz")
+		NewFiles(t, dir, "other", "other.log.1", "application.log.old")
+
+		namer := ShiftingNamer{}
+
+		current := filepath.Join(dir, "application.log")
+		newName, err := namer.Name(current)
+		r.NoErr(err) // should not be any error
+		r.Equal(newName, filepath.Join(dir, "application.log.1"))
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application.log.2",
+			"application.log.3.gz",
+			"application.log.4.gz",
+			"application.log.old",
+			"other.log.1",
+		})
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "application.log.4.gz"))
+		r.NoErr(err)               // should not be any error
+		r.Equal(string(data), "3") // oldest archive should be shifted last
+	})
+
+	t.Run("chain with gap", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+		NewFiles(t, dir, "1", "application.log.1.gz")
+		NewFiles(t, dir, "2", "application.log.2.gz")
+		NewFiles(t, dir, "4", "application.log.4.gz")
+
+		namer := ShiftingNamer{}
+
+		current := filepath.Join(dir, "application.log")
+		_, err := namer.Name(current)
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application.log.2.gz",
+			"application.log.3.gz",
+			"application.log.4.gz",
+		})
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "application.log.4.gz"))
+		r.NoErr(err)               // should not be any error
+		r.Equal(string(data), "4") // archive after gap should not be shifted
+	})
+
+	t.Run("chain longer than max archives", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+		NewFiles(t, dir, "1", "application.log.1")
+		NewFiles(t, dir, "2", "application.log.2.gz")
+		NewFiles(t, dir, "3", "application.log.3.gz")
+		NewFiles(t, dir, "7", "application.log.7.gz")
+
+		namer := ShiftingNamer{MaxArchives: 3}
+
+		current := filepath.Join(dir, "application.log")
+		_, err := namer.Name(current)
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application.log.2",
+			"application.log.3.gz",
+		})
+	})
+}
+
+func TestNewTemplateNamer(t *testing.T) {
+	t.Parallel()
+
+	for _, pattern := range []string{
+		"",
+		"{base}-{unknown}{ext}",
+		"{base}-%Q{ext}",
+		"{base}-{mtime:%Q}{ext}",
+		"{base}.{seq}.{seq}{ext}",
+		"{seq}/{base}{ext}",
+		"{base{ext}",
+		"{base}}{ext}",
+		"{base}%",
+	} {
+		pattern := pattern
+		t.Run(pattern, func(t *testing.T) {
+			t.Parallel()
+			r := is.New(t)
+
+			namer, err := NewTemplateNamer(pattern)
+			r.True(err != nil)   // should be non nil
+			r.True(namer == nil) // namer should not be returned
+		})
+	}
+}
+
+func TestTemplateNamer_Name(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pattern renders to directory", func(t *testing.T) {
+		t.Parallel()
+
+		for _, pattern := range []string{"{reason}", "{dir}", "{reason}/"} {
+			pattern := pattern
+			t.Run(pattern, func(t *testing.T) {
+				t.Parallel()
+				r := is.New(t)
+
+				dir := SetupDir(t)
+				CleanupDir(t, dir)
+				NewFiles(t, dir, "current", "application.log")
+				current := filepath.Join(dir, "application.log")
+
+				namer, err := NewTemplateNamer(pattern)
+				r.NoErr(err) // should not be any error
+				namer.ReasonFunc = func() string { return "" }
+
+				name, err := namer.Name(current)
+				r.True(err != nil)     // should be non nil
+				r.Equal(name, current) // path returned should be same as given path
+			})
+		}
+	})
+
+	t.Run("zero value namer", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+		current := filepath.Join(dir, "application.log")
+
+		name, err := (&TemplateNamer{}).Name(current)
+		r.True(err != nil)     // should be non nil
+		r.Equal(name, current) // path returned should be same as given path
+
+		_, err = (&TemplateNamer{}).Parse(current)
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("no file at current path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		namer, err := NewTemplateNamer("{base}.{seq}{ext}")
+		r.NoErr(err) // should not be any error
+
+		// Hopefully this is random
+		randomPath := filepath.Join(dir, "g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn")
+
+		name, err := namer.Name(randomPath)
+		r.True(err != nil)         // should be non nil
+		r.True(name == randomPath) // path returned should be same as given path
+	})
+
+	t.Run("fields and rotation time", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+
+		err := os.Chtimes(filepath.Join(dir, "application.log"), testTime, testTime)
+		r.NoErr(err) // should not be any error
+
+		namer, err := NewTemplateNamer("{dir}/archive/{base}-{host}-{pid}-{reason}-%Y%m%dT%H%M-{mtime:%F}.{seq}{ext}")
+		r.NoErr(err) // should not be any error
+		namer.NowFunc = func() time.Time { return testTime.Add(time.Hour) }
+		namer.ReasonFunc = func() string { return "size" }
+
+		host, err := os.Hostname()
+		r.NoErr(err) // should not be any error
+
+		newName, err := namer.Name(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(newName, filepath.Join(dir, "archive", fmt.Sprintf("application-%s-%d-size-20210101T0715-2021-01-01.0.log", host, os.Getpid())))
+
+		stat, err := os.Stat(filepath.Join(dir, "archive"))
+		r.NoErr(err)         // should not be any error
+		r.True(stat.IsDir()) // archive directory should be created
+	})
+
+	t.Run("relative pattern with existing sequence", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+		NewFiles(t, dir, "archive", "application-20210101.0.log", "application-20210101.3.log", "application-20210102.7.log")
+
+		namer, err := NewTemplateNamer("{base}-%Y%m%d.{seq}{ext}")
+		r.NoErr(err) // should not be any error
+		namer.NowFunc = func() time.Time { return testTime }
+
+		newName, err := namer.Name(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(newName, filepath.Join(dir, "application-20210101.4.log"))
+	})
+
+	t.Run("sequence of compressed archives", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+
+		namer, err := NewTemplateNamer("{base}.{seq}{ext}")
+		r.NoErr(err) // should not be any error
+		rename := RenameTransformer{Namer: namer}
+		compress := GzipTransformer{}
+
+		for i := 0; i < 2; i++ {
+			NewFiles(t, dir, "current", "application.log")
+			path, err := rename.Transform(filepath.Join(dir, "application.log"))
+			r.NoErr(err) // should not be any error
+			_, err = compress.Transform(path)
+			r.NoErr(err) // should not be any error
+		}
+		r.Equal(DirFiles(t, dir), []string{"application.0.log.gz", "application.1.log.gz"}) // compressed archives should not be reused
+	})
+
+	t.Run("pattern without sequence", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+
+		namer, err := NewTemplateNamer("{name}-%%-%s")
+		r.NoErr(err) // should not be any error
+		namer.NowFunc = func() time.Time { return testTime }
+
+		newName, err := namer.Name(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(newName, filepath.Join(dir, fmt.Sprintf("application.log-%%-%d", testTime.Unix())))
+	})
+}
+
+func TestPartitionNamer_Name(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no file at current path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		namer := PartitionNamer{}
+
+		// Hopefully this is random
+		randomPath := filepath.Join(dir, "g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn")
+
+		name, err := namer.Name(randomPath)
+		r.True(err != nil)         // should be non nil
+		r.True(name == randomPath) // path returned should be same as given path
+	})
+
+	t.Run("directory at current path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		namer := PartitionNamer{}
+
+		name, err := namer.Name(dir)
+		r.True(err != nil)  // should be non nil
+		r.True(name == dir) // path returned should be same as given path
+	})
+
+	t.Run("new partition", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log", "application_2021-01-01.5.log")
+
+		err := os.Chtimes(filepath.Join(dir, "application.log"), testTime, testTime)
+		r.NoErr(err) // should not be any error
+
+		namer := PartitionNamer{DirMode: 0700}
+
+		newName, err := namer.Name(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(newName, filepath.Join(dir, "2021", "01", "01", "application_2021-01-01.0.log"))
+
+		stat, err := os.Stat(filepath.Join(dir, "2021", "01", "01"))
+		r.NoErr(err)                       // should not be any error
+		r.True(stat.IsDir())               // partition directory should be created
+		r.True(stat.Mode().Perm() == 0700) // partition directory should have given mode
+	})
+
+	t.Run("existing partition with hive layout", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		root := filepath.Join(dir, "archive")
+		partition := filepath.Join(root, "dt=2021-01-01")
+		err := os.MkdirAll(partition, 0755)
+		r.NoErr(err) // should not be any error
+		NewFiles(t, dir, "current", "application.log")
+		NewFiles(t, partition, "archive", "application_20210101.0.log", "application_20210101.1.log")
+
+		err = os.Chtimes(filepath.Join(dir, "application.log"), testTime, testTime)
+		r.NoErr(err) // should not be any error
+
+		namer := PartitionNamer{Root: root, PartitionLayout: "dt=2006-01-02", TimestampFormat: "20060102"}
+
+		newName, err := namer.Name(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(newName, filepath.Join(partition, "application_20210101.2.log"))
+	})
+
+	t.Run("sequence of compressed archives", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		partition := filepath.Join(dir, "2021", "01", "01")
+
+		rename := RenameTransformer{Namer: PartitionNamer{}}
+		compress := GzipTransformer{}
+
+		for i := 0; i < 2; i++ {
+			NewFiles(t, dir, "current", "application.log")
+			err := os.Chtimes(filepath.Join(dir, "application.log"), testTime, testTime)
+			r.NoErr(err) // should not be any error
+			path, err := rename.Transform(filepath.Join(dir, "application.log"))
+			r.NoErr(err) // should not be any error
+			_, err = compress.Transform(path)
+			r.NoErr(err) // should not be any error
+		}
+		r.Equal(DirFiles(t, partition), []string{"application_2021-01-01.0.log.gz", "application_2021-01-01.1.log.gz"}) // compressed archives should not be reused
+	})
+}
+
+func TestTimestampSequenceNamer_Parse(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not an archive", func(t *testing.T) {
+		t.Parallel()
+
+		for _, path := range []string{
+			"application.log",
+			"application_2021-01-02.log",
+			"application_2021-13-02.0.log",
+			"application_2021-01-02.x.log",
+			"application.log.1.gz",
+		} {
+			r := is.New(t)
+
+			_, err := TimestampSequenceNamer{}.Parse(path)
+			r.True(errors.Is(err, ErrNotArchive)) // error should wrap ErrNotArchive
+		}
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		archive, err := TimestampSequenceNamer{}.Parse("/var/log/my_application_2021-01-02.3.log.gz")
+		r.NoErr(err) // should not be any error
+		r.Equal(archive.Path, "/var/log/my_application_2021-01-02.3.log.gz")
+		r.Equal(archive.Base, "my_application")
+		r.Equal(archive.Ext, ".log")
+		r.Equal(archive.Suffix, ".gz")
+		r.Equal(archive.Sequence, 3)
+		r.True(archive.Timestamp.Equal(time.Date(2021, 1, 2, 0, 0, 0, 0, time.Local)))
+		r.Equal(archive.Name(), "my_application.log")
+	})
+
+	t.Run("round trip with custom format", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+
+		modTime := time.Date(2021, 1, 2, 15, 4, 5, 0, time.Local)
+		err := os.Chtimes(filepath.Join(dir, "application.log"), modTime, modTime)
+		r.NoErr(err) // should not be any error
+
+		namer := TimestampSequenceNamer{TimestampFormat: "2006-01-02_15-04-05"}
+
+		newName, err := namer.Name(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+
+		archive, err := namer.Parse(newName)
+		r.NoErr(err) // should not be any error
+		r.Equal(archive.Name(), "application.log")
+		r.Equal(archive.Sequence, 0)
+		r.True(archive.Timestamp.Equal(modTime))
+	})
+}
+
+func TestShiftingNamer_Parse(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not an archive", func(t *testing.T) {
+		t.Parallel()
+
+		for _, path := range []string{
+			"application.log",
+			"application.log.0",
+			"application.log.gz",
+		} {
+			r := is.New(t)
+
+			_, err := ShiftingNamer{}.Parse(path)
+			r.True(errors.Is(err, ErrNotArchive)) // error should wrap ErrNotArchive
+		}
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		archive, err := ShiftingNamer{}.Parse("/var/log/application.log.12.gz")
+		r.NoErr(err) // should not be any error
+		r.Equal(archive.Base, "application")
+		r.Equal(archive.Ext, ".log")
+		r.Equal(archive.Suffix, ".gz")
+		r.Equal(archive.Sequence, 12)
+		r.True(archive.Timestamp.IsZero()) // shifted archives do not encode timestamp
+	})
+}
+
+func TestPartitionNamer_Parse(t *testing.T) {
+	t.Parallel()
+	r := is.New(t)
+
+	archive, err := PartitionNamer{TimestampFormat: "20060102"}.Parse("/var/log/dt=2021-01-02/application_20210102.1.log")
+	r.NoErr(err) // should not be any error
+	r.Equal(archive.Name(), "application.log")
+	r.Equal(archive.Sequence, 1)
+	r.True(archive.Timestamp.Equal(time.Date(2021, 1, 2, 0, 0, 0, 0, time.Local)))
+}
+
+func TestTemplateNamer_Parse(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not an archive", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		namer, err := NewTemplateNamer("{dir}/archive/{base}-%Y%m%dT%H%M.{seq}{ext}")
+		r.NoErr(err) // should not be any error
+
+		_, err = namer.Parse("/var/log/application.log")
+		r.True(errors.Is(err, ErrNotArchive)) // error should wrap ErrNotArchive
+
+		_, err = namer.Parse("/var/log/archive/application-20211301T0000.0.log")
+		r.True(errors.Is(err, ErrNotArchive)) // error should wrap ErrNotArchive
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+
+		namer, err := NewTemplateNamer("{dir}/archive/{base}-{host}-{pid}-%Y%m%dT%H%M.{seq}{ext}")
+		r.NoErr(err) // should not be any error
+		rotatedAt := time.Date(2021, 1, 2, 15, 4, 0, 0, time.Local)
+		namer.NowFunc = func() time.Time { return rotatedAt }
+
+		newName, err := namer.Name(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+
+		archive, err := namer.Parse(newName + ".gz")
+		r.NoErr(err) // should not be any error
+		r.Equal(archive.Base, "application")
+		r.Equal(archive.Ext, ".log")
+		r.Equal(archive.Suffix, ".gz")
+		r.Equal(archive.Sequence, 0)
+		r.True(archive.Timestamp.Equal(rotatedAt))
+	})
+
+	t.Run("name placeholder and mtime", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		namer, err := NewTemplateNamer("{name}.{mtime:%F}")
+		r.NoErr(err) // should not be any error
+
+		archive, err := namer.Parse("/var/log/application.log.2021-01-02.zst")
+		r.NoErr(err) // should not be any error
+		r.Equal(archive.Name(), "application.log")
+		r.Equal(archive.Suffix, ".zst")
+		r.True(archive.Timestamp.Equal(time.Date(2021, 1, 2, 0, 0, 0, 0, time.Local)))
+	})
+}
+
+func TestTimestampSequenceNamer_Name_TimeSource(t *testing.T) {
+	t.Parallel()
+
+	content := "2021-01-02T10:00:12Z started\n" +
+		"continued without timestamp\n" +
+		"2021-01-02T10:30:00Z running\n" +
+		"2021-01-02T10:59:59Z stopped\n" +
+		"trailing without timestamp\n"
+
+	t.Run("rotation time", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, content, "application.log")
+
+		namer := TimestampSequenceNamer{
+			TimestampFormat: "2006-01-02T15:04",
+			TimeSource:      RotationTime(func() time.Time { return testTime }),
+		}
+
+		newName, err := namer.Name(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(newName, filepath.Join(dir, "application_2021-01-01T06:15.0.log"))
+	})
+
+	t.Run("record time range", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, content, "application.log")
+		NewFiles(t, dir, "archive", "application_2021-01-02T10:00--10:59.0.log")
+
+		namer := TimestampSequenceNamer{
+			TimestampFormat:    "2006-01-02T15:04",
+			TimeSource:         FirstRecordTime(time.RFC3339),
+			EndTimeSource:      LastRecordTime(time.RFC3339),
+			EndTimestampFormat: "15:04",
+		}
+
+		newName, err := namer.Name(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(newName, filepath.Join(dir, "application_2021-01-02T10:00--10:59.1.log"))
+
+		archive, err := namer.Parse(newName)
+		r.NoErr(err) // should not be any error
+		r.Equal(archive.Name(), "application.log")
+		r.Equal(archive.Sequence, 1)
+		r.True(archive.Timestamp.Equal(time.Date(2021, 1, 2, 10, 0, 0, 0, time.Local))) // start of range should be parsed
+	})
+
+	t.Run("no record with timestamp", func(t *testing.T) {
+		t.Parallel()
+
+		for name, content := range map[string]string{"empty": "", "continuation lines": "no timestamps here\n  at main\n"} {
+			content := content
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				r := is.New(t)
+
+				dir := SetupDir(t)
+				CleanupDir(t, dir)
+				NewFiles(t, dir, content, "application.log")
+				current := filepath.Join(dir, "application.log")
+				err := os.Chtimes(current, testTime, testTime)
+				r.NoErr(err) // should not be any error
+
+				namer := TimestampSequenceNamer{
+					TimestampFormat: "2006-01-02T15:04",
+					TimeSource:      FirstRecordTime(time.RFC3339),
+					EndTimeSource:   LastRecordTime(time.RFC3339),
+				}
+
+				newName, err := namer.Name(current)
+				r.NoErr(err)                                                                                 // should not be any error
+				r.Equal(newName, filepath.Join(dir, "application_2021-01-01T06:15--2021-01-01T06:15.0.log")) // mtime should be used
+			})
+		}
+	})
+}
+
+func TestRecordTime(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		record string
+		layout string
+		want   time.Time
+		ok     bool
+	}{
+		{record: "2021-01-02T10:00:00Z hello", layout: time.RFC3339, want: time.Date(2021, 1, 2, 10, 0, 0, 0, time.UTC), ok: true},
+		{record: "2021-01-02 10:00:00 hello world", layout: "2006-01-02 15:04:05", want: time.Date(2021, 1, 2, 10, 0, 0, 0, time.Local), ok: true},
+		{record: "[2021-01-02 10:00:00] hello", layout: "2006-01-02 15:04:05", want: time.Date(2021, 1, 2, 10, 0, 0, 0, time.Local), ok: true},
+		{record: "2021-01-02T10:00:00Z\r\n", layout: time.RFC3339, want: time.Date(2021, 1, 2, 10, 0, 0, 0, time.UTC), ok: true},
+		{record: "hello 2021-01-02T10:00:00Z", layout: time.RFC3339},
+		{record: "", layout: time.RFC3339},
+	} {
+		r := is.New(t)
+
+		got, ok := RecordTime([]byte(tc.record), tc.layout)
+		r.Equal(ok, tc.ok)
+		r.True(got.Equal(tc.want))
+	}
+}
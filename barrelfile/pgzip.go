@@ -0,0 +1,243 @@
+package barrelfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultGzipBlockSize is the size of uncompressed blocks compressed
+// concurrently by ParallelGzipWriter, if no block size is given.
+const DefaultGzipBlockSize = 1 << 20
+
+// ParallelGzipWriter is an io.WriteCloser which compresses the bytes written to
+// it in blocks on multiple goroutines.
+//
+// Every block is written as a separate gzip member, in order, making the output
+// a multi-member gzip stream. Such stream is readable by compress/gzip, gzip(1)
+// and any other RFC 1952 compliant reader, which decompress it as a single
+// concatenated stream. Compression ratio is slightly worse than a single member
+// stream, as dictionary is not shared between blocks.
+type ParallelGzipWriter struct {
+	w         io.Writer
+	level     int
+	blockSize int
+
+	buf     []byte
+	written bool
+	pool    sync.Pool
+
+	pending chan chan gzipBlock
+	done    chan struct{}
+
+	mu  sync.Mutex
+	err error
+
+	closed bool
+
+	// index is built when the writer is seekable.
+	index      *GzipIndex
+	timeLayout string
+}
+
+// gzipBlock is the result of compression of a block.
+type gzipBlock struct {
+	data *bytes.Buffer
+	size int
+	time time.Time
+	err  error
+}
+
+// NewParallelGzipWriter returns a ParallelGzipWriter writing gzip stream to w,
+// compressed at given level, in blocks of blockSize bytes, on at most workers
+// goroutines. If blockSize is not positive DefaultGzipBlockSize is used, and if
+// workers is not positive runtime.GOMAXPROCS(0) is used.
+//
+// At most 2*workers blocks are held in memory at any time.
+func NewParallelGzipWriter(w io.Writer, level, blockSize, workers int) (*ParallelGzipWriter, error) {
+	if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+		return nil, fmt.Errorf("gzip new writer level: %w", err)
+	}
+	if blockSize <= 0 {
+		blockSize = DefaultGzipBlockSize
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	pw := &ParallelGzipWriter{
+		w:         w,
+		level:     level,
+		blockSize: blockSize,
+		buf:       make([]byte, 0, blockSize),
+		pending:   make(chan chan gzipBlock, workers),
+		done:      make(chan struct{}),
+	}
+	go pw.drain()
+	return pw, nil
+}
+
+// NewSeekableGzipWriter returns a ParallelGzipWriter, which also builds a
+// GzipIndex of the written blocks, allowing to seek within the written gzip
+// stream with SeekableGzipReader. Blocks are cut after the last newline
+// within blockSize bytes, so that records are not split between blocks.
+//
+// If timeLayout is not empty, the time of the first record of every block is
+// parsed with RecordTime and recorded in the index, allowing to seek by time.
+func NewSeekableGzipWriter(w io.Writer, level, blockSize, workers int, timeLayout string) (*ParallelGzipWriter, error) {
+	pw, err := NewParallelGzipWriter(w, level, blockSize, workers)
+	if err != nil {
+		return nil, err
+	}
+	pw.index = &GzipIndex{}
+	pw.timeLayout = timeLayout
+	return pw, nil
+}
+
+// Index returns the index of the written blocks, complete once the writer is
+// closed. It returns nil if the writer is not seekable.
+func (pw *ParallelGzipWriter) Index() *GzipIndex {
+	return pw.index
+}
+
+// Write buffers p, and compresses it in the background once a block is full.
+// Errors of compression or of the underlying writer are returned by later
+// calls of Write or Close.
+func (pw *ParallelGzipWriter) Write(p []byte) (int, error) {
+	if pw.closed {
+		return 0, fmt.Errorf("write to closed parallel gzip writer")
+	}
+	if err := pw.error(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for len(p) > 0 {
+		c := copy(pw.buf[len(pw.buf):cap(pw.buf)], p)
+		pw.buf = pw.buf[:len(pw.buf)+c]
+		n += c
+		p = p[c:]
+		if len(pw.buf) == cap(pw.buf) {
+			pw.dispatch()
+		}
+	}
+	return n, nil
+}
+
+// Close compresses the remaining buffered bytes, and waits for all the blocks
+// to be written to the underlying writer. It does not close the underlying
+// writer.
+func (pw *ParallelGzipWriter) Close() error {
+	if pw.closed {
+		return fmt.Errorf("close closed parallel gzip writer")
+	}
+	pw.closed = true
+	// empty input is still written as a single empty member, so that result is
+	// a valid gzip stream.
+	if len(pw.buf) > 0 || !pw.written {
+		pw.dispatch()
+	}
+	close(pw.pending)
+	<-pw.done
+	return pw.error()
+}
+
+// dispatch compresses the current block in the background, and starts a new
+// one. It blocks while too many blocks are pending to be written.
+//
+// For seekable writers, a full block is cut after its last newline, and the
+// rest of it starts the new block.
+func (pw *ParallelGzipWriter) dispatch() {
+	block := pw.buf
+	pw.buf = make([]byte, 0, pw.blockSize)
+	if pw.index != nil && len(block) == cap(block) {
+		if i := bytes.LastIndexByte(block, '\n'); i >= 0 {
+			pw.buf = append(pw.buf, block[i+1:]...)
+			block = block[:i+1]
+		}
+	}
+	result := make(chan gzipBlock, 1)
+	pw.pending <- result
+	pw.written = true
+	go func() {
+		result <- pw.compress(block)
+	}()
+}
+
+// compress compresses block as a complete gzip member.
+func (pw *ParallelGzipWriter) compress(block []byte) gzipBlock {
+	buf := &bytes.Buffer{}
+	gzw, ok := pw.pool.Get().(*gzip.Writer)
+	if ok {
+		gzw.Reset(buf)
+	} else {
+		var err error
+		gzw, err = gzip.NewWriterLevel(buf, pw.level)
+		if err != nil {
+			return gzipBlock{err: fmt.Errorf("gzip new writer level: %w", err)}
+		}
+	}
+	defer pw.pool.Put(gzw)
+	if _, err := gzw.Write(block); err != nil {
+		return gzipBlock{err: fmt.Errorf("gzip write: %w", err)}
+	}
+	if err := gzw.Close(); err != nil {
+		return gzipBlock{err: fmt.Errorf("gzip close: %w", err)}
+	}
+	result := gzipBlock{data: buf, size: len(block)}
+	if pw.timeLayout != "" {
+		record := block
+		if i := bytes.IndexByte(record, '\n'); i >= 0 {
+			record = record[:i]
+		}
+		if ts, ok := RecordTime(record, pw.timeLayout); ok {
+			result.time = ts
+		}
+	}
+	return result
+}
+
+// drain writes the compressed blocks to the underlying writer in the order in
+// which they were dispatched. After the first error rest of the blocks are
+// discarded.
+func (pw *ParallelGzipWriter) drain() {
+	defer close(pw.done)
+	for result := range pw.pending {
+		block := <-result
+		if pw.error() != nil {
+			continue
+		}
+		if block.err != nil {
+			pw.setError(block.err)
+			continue
+		}
+		compressedSize := int64(block.data.Len())
+		if _, err := block.data.WriteTo(pw.w); err != nil {
+			pw.setError(fmt.Errorf("write compressed block: %w", err))
+			continue
+		}
+		if pw.index != nil {
+			pw.index.Blocks = append(pw.index.Blocks, GzipIndexBlock{
+				UncompressedOffset: pw.index.UncompressedSize,
+				CompressedOffset:   pw.index.CompressedSize,
+				Time:               block.time,
+			})
+			pw.index.UncompressedSize += int64(block.size)
+			pw.index.CompressedSize += compressedSize
+		}
+	}
+}
+
+func (pw *ParallelGzipWriter) error() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.err
+}
+
+func (pw *ParallelGzipWriter) setError(err error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.err = err
+}
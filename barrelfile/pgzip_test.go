@@ -0,0 +1,173 @@
+package barrelfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestParallelGzipWriter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("invalid gzip level", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, err := NewParallelGzipWriter(&bytes.Buffer{}, -100, 0, 0)
+		r.True(err != nil) // should be non nil
+	})
+
+	for _, size := range []int{0, 1, 1000, 4096, 4097, 3*4096 + 17, 1 << 20} {
+		for _, workers := range []int{1, 4} {
+			size, workers := size, workers
+			t.Run(fmt.Sprintf("round trip %d bytes on %d workers", size, workers), func(t *testing.T) {
+				t.Parallel()
+				r := is.New(t)
+
+				content := gzipTestData(size)
+
+				var buf bytes.Buffer
+				pw, err := NewParallelGzipWriter(&buf, gzip.DefaultCompression, 4096, workers)
+				r.NoErr(err) // should not be any error
+
+				// write in uneven chunks, to cross block boundaries
+				for p := content; len(p) > 0; {
+					n := 1 + rand.Intn(3000)
+					if n > len(p) {
+						n = len(p)
+					}
+					_, err := pw.Write(p[:n])
+					r.NoErr(err) // should not be any error
+					p = p[n:]
+				}
+				err = pw.Close()
+				r.NoErr(err) // should not be any error
+
+				gzr, err := gzip.NewReader(&buf)
+				r.NoErr(err) // should not be any error
+				decompressed, err := ioutil.ReadAll(gzr)
+				r.NoErr(err)                               // should not be any error
+				r.True(bytes.Equal(decompressed, content)) // decompressed content should be same as original
+			})
+		}
+	}
+
+	t.Run("same content as compress gzip", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		content := gzipTestData(100000)
+
+		var single bytes.Buffer
+		gzw := gzip.NewWriter(&single)
+		_, err := gzw.Write(content)
+		r.NoErr(err) // should not be any error
+		err = gzw.Close()
+		r.NoErr(err) // should not be any error
+
+		var parallel bytes.Buffer
+		pw, err := NewParallelGzipWriter(&parallel, gzip.DefaultCompression, 8192, 4)
+		r.NoErr(err) // should not be any error
+		_, err = pw.Write(content)
+		r.NoErr(err) // should not be any error
+		err = pw.Close()
+		r.NoErr(err) // should not be any error
+
+		decompress := func(data []byte) []byte {
+			gzr, err := gzip.NewReader(bytes.NewReader(data))
+			r.NoErr(err) // should not be any error
+			out, err := ioutil.ReadAll(gzr)
+			r.NoErr(err) // should not be any error
+			return out
+		}
+		r.True(bytes.Equal(decompress(single.Bytes()), decompress(parallel.Bytes()))) // both streams should decompress to same content
+	})
+
+	t.Run("underlying writer errors", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		pw, err := NewParallelGzipWriter(faultyWriter{Err: errWriter}, gzip.DefaultCompression, 16, 2)
+		r.NoErr(err) // should not be any error
+
+		for i := 0; i < 10; i++ {
+			if _, err = pw.Write([]byte(testText)); err != nil {
+				break
+			}
+		}
+		if cerr := pw.Close(); err == nil {
+			err = cerr
+		}
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("write after close", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		pw, err := NewParallelGzipWriter(&bytes.Buffer{}, gzip.DefaultCompression, 0, 0)
+		r.NoErr(err) // should not be any error
+
+		err = pw.Close()
+		r.NoErr(err) // should not be any error
+
+		_, err = pw.Write([]byte("hello"))
+		r.True(err != nil) // should be non nil
+
+		err = pw.Close()
+		r.True(err != nil) // should be non nil
+	})
+}
+
+func BenchmarkGzip(b *testing.B) {
+	content := gzipTestData(32 << 20)
+
+	b.Run("compress gzip", func(b *testing.B) {
+		b.SetBytes(int64(len(content)))
+		for i := 0; i < b.N; i++ {
+			gzw := gzip.NewWriter(ioutil.Discard)
+			if _, err := gzw.Write(content); err != nil {
+				b.Fatal(err)
+			}
+			if err := gzw.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, workers := range []int{2, 4, 8} {
+		workers := workers
+		b.Run(fmt.Sprintf("parallel gzip %d workers", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			for i := 0; i < b.N; i++ {
+				pw, err := NewParallelGzipWriter(ioutil.Discard, gzip.DefaultCompression, 0, workers)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := pw.Write(content); err != nil {
+					b.Fatal(err)
+				}
+				if err := pw.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// gzipTestData returns size bytes of log like, compressible content.
+func gzipTestData(size int) []byte {
+	rnd := rand.New(rand.NewSource(int64(size)))
+	words := strings.Fields(testText)
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		fmt.Fprintf(&buf, "%d %s\n", rnd.Int63(), words[rnd.Intn(len(words))])
+	}
+	return buf.Bytes()[:size]
+}
@@ -0,0 +1,139 @@
+package barrelfile
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RetentionTransformer removes old archives of the file, it is expected to be
+// used after the transformers generating the archive. Limits on number, age
+// and total size of the archives can be combined, archives exceeding any of
+// the limits are removed, oldest first, along with their sidecar files.
+type RetentionTransformer struct {
+	// Parser used to discover the archives of the file, it should correspond
+	// to the Namer generating the archives.
+	Parser Parser
+
+	// Dir is the directory searched, including nested directories, for the
+	// archives. If unset, it will correspond to the directory of the file.
+	Dir string
+
+	// MaxArchives is the max number of archives kept. If unset (ie. 0), number
+	// of archives is not limited.
+	MaxArchives int
+
+	// MaxAge is the max age of archives kept. Age of an archive is determined
+	// from the timestamp parsed from its name, or its mtime. If unset (ie. 0),
+	// age of archives is not limited.
+	MaxAge time.Duration
+
+	// MaxTotalSize is the max total size, in bytes, of archives kept. If unset
+	// (ie. 0), total size of archives is not limited.
+	MaxTotalSize int64
+
+	// NowFunc to wrap stdlib time.Now for testing.
+	NowFunc func() time.Time
+
+	// DryRun only logs the archives which would be removed.
+	DryRun bool
+
+	// Logger logs the removed archives. If unset, nothing is logged.
+	Logger *log.Logger
+}
+
+// Transform discovers the archives of the file, which the file at the given
+// path is an archive of, as parsed by the Parser, and removes the archives
+// exceeding MaxArchives, MaxAge or MaxTotalSize. If the given path is not of
+// an archive, then it is considered as the file itself. The given path is
+// returned unchanged.
+//
+// If there are any errors while discovering or removing the archives then
+// non-nil error is returned.
+func (t RetentionTransformer) Transform(path string) (string, error) {
+	current := path
+	if archive, err := t.Parser.Parse(path); err == nil {
+		current = filepath.Join(filepath.Dir(path), archive.Name())
+	}
+	if err := t.Sweep(current); err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// Sweep discovers the archives of the file at current path, as parsed by the
+// Parser, and removes the archives exceeding MaxArchives, MaxAge or
+// MaxTotalSize.
+//
+// If there are any errors while discovering or removing the archives then
+// non-nil error is returned.
+func (t RetentionTransformer) Sweep(current string) error {
+	dir := t.Dir
+	if len(dir) == 0 {
+		dir = filepath.Dir(current)
+	}
+
+	archives, err := FindArchives(dir, current, t.Parser)
+	if err != nil {
+		return fmt.Errorf("find archives: %w", err)
+	}
+	for _, archive := range t.expired(archives) {
+		if t.DryRun {
+			logf(t.Logger, "retention: would remove %s", archive.Path)
+			continue
+		}
+		if err := os.Remove(archive.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("os remove archive: %w", err)
+		}
+		if err := removeSidecars(archive.Path); err != nil {
+			return err
+		}
+		logf(t.Logger, "retention: removed %s", archive.Path)
+	}
+	return nil
+}
+
+// StartSweep runs Sweep for the file at current path every interval in a
+// separate goroutine, until the returned stop function is called. Errors are
+// logged to the Logger.
+func (t RetentionTransformer) StartSweep(current string, interval time.Duration) (stop func()) {
+	return startSweep(interval, func() error { return t.Sweep(current) }, t.Logger, "retention: sweep "+current)
+}
+
+// expired returns the archives to be removed, from the given archives ordered
+// from the oldest to the newest.
+func (t RetentionTransformer) expired(archives []Archive) []Archive {
+	var nowTime time.Time
+	if t.NowFunc != nil {
+		nowTime = t.NowFunc()
+	} else {
+		nowTime = time.Now()
+	}
+
+	// archives before idx are removed, it only moves forward as each limit
+	// keeps the newest archives.
+	idx := 0
+	if t.MaxArchives > 0 && len(archives) > t.MaxArchives {
+		idx = len(archives) - t.MaxArchives
+	}
+	if t.MaxAge > 0 {
+		for i := idx; i < len(archives); i++ {
+			if nowTime.Sub(archives[i].Time()) > t.MaxAge {
+				idx = i + 1
+			}
+		}
+	}
+	if t.MaxTotalSize > 0 {
+		var total int64
+		for i := len(archives) - 1; i >= idx; i-- {
+			total += archives[i].Size
+			if total > t.MaxTotalSize {
+				idx = i + 1
+				break
+			}
+		}
+	}
+	return archives[:idx]
+}
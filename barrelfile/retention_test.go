@@ -0,0 +1,207 @@
+package barrelfile
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRetentionTransformer_Transform(t *testing.T) {
+	t.Parallel()
+
+	t.Run("fewer archives than max", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t, "application.log.2.gz", "application.log.1")
+
+		transformer := RetentionTransformer{Parser: ShiftingNamer{}, MaxArchives: 5}
+
+		path, err := transformer.Transform(filepath.Join(dir, "application.log.1"))
+		r.NoErr(err)                                           // should not be any error
+		r.Equal(path, filepath.Join(dir, "application.log.1")) // path should be unchanged
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1", "application.log.2.gz", "other.log.1"})
+	})
+
+	t.Run("more archives than max", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t,
+			"application_2021-01-01.0.log.gz",
+			"application_2021-01-01.1.log.gz",
+			"application_2021-01-02.0.log.gz",
+			"application_2021-01-03.0.log",
+		)
+
+		var logs bytes.Buffer
+		transformer := RetentionTransformer{
+			Parser:      TimestampSequenceNamer{},
+			MaxArchives: 2,
+			Logger:      log.New(&logs, "", 0),
+		}
+
+		_, err := transformer.Transform(filepath.Join(dir, "application_2021-01-03.0.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application_2021-01-02.0.log.gz",
+			"application_2021-01-03.0.log",
+			"other.log.1",
+		})
+		r.True(strings.Contains(logs.String(), "removed "+filepath.Join(dir, "application_2021-01-01.0.log.gz"))) // removal should be logged
+		r.True(strings.Contains(logs.String(), "removed "+filepath.Join(dir, "application_2021-01-01.1.log.gz"))) // removal should be logged
+	})
+
+	t.Run("sidecars are removed with archive", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t, "application.log.2.gz", "application.log.2.gz.idx", "application.log.2.gz.sha256", "application.log.1.gz", "application.log.1.gz.idx")
+
+		transformer := RetentionTransformer{Parser: ShiftingNamer{}, MaxArchives: 1}
+
+		_, err := transformer.Transform(filepath.Join(dir, "application.log.1.gz"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1.gz", "application.log.1.gz.idx", "other.log.1"})
+	})
+
+	t.Run("transform of the file itself", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t, "application.log.3", "application.log.2", "application.log.1")
+
+		transformer := RetentionTransformer{Parser: ShiftingNamer{}, MaxArchives: 1}
+
+		_, err := transformer.Transform(filepath.Join(dir, "application.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1", "other.log.1"})
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t, "application.log.2", "application.log.1")
+
+		var logs bytes.Buffer
+		transformer := RetentionTransformer{
+			Parser:      ShiftingNamer{},
+			MaxArchives: 1,
+			DryRun:      true,
+			Logger:      log.New(&logs, "", 0),
+		}
+
+		_, err := transformer.Transform(filepath.Join(dir, "application.log.1"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1", "application.log.2", "other.log.1"})
+		r.Equal(logs.String(), "retention: would remove "+filepath.Join(dir, "application.log.2")+"\n")
+	})
+
+	t.Run("archives older than max age", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t, "application.log.3", "application.log.2", "application.log.1")
+
+		transformer := RetentionTransformer{
+			Parser:  ShiftingNamer{},
+			MaxAge:  90 * time.Minute,
+			NowFunc: func() time.Time { return testTime.Add(3 * time.Hour) },
+		}
+
+		_, err := transformer.Transform(filepath.Join(dir, "application.log.1"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1", "other.log.1"})
+	})
+
+	t.Run("archives older than max age by name", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t,
+			"application_2020-12-01.0.log.gz",
+			"application_2020-12-31.0.log.gz",
+			"application_2021-01-01.0.log",
+		)
+		// mtime is not used when the name has a timestamp
+		err := os.Chtimes(filepath.Join(dir, "application_2020-12-01.0.log.gz"), testTime, testTime)
+		r.NoErr(err) // should not be any error
+
+		transformer := RetentionTransformer{
+			Parser:  TimestampSequenceNamer{},
+			MaxAge:  30 * 24 * time.Hour,
+			NowFunc: func() time.Time { return time.Date(2021, 1, 2, 0, 0, 0, 0, time.Local) },
+		}
+
+		_, err = transformer.Transform(filepath.Join(dir, "application_2021-01-01.0.log"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{
+			"application.log",
+			"application_2020-12-31.0.log.gz",
+			"application_2021-01-01.0.log",
+			"other.log.1",
+		})
+	})
+
+	t.Run("archives exceeding total size", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		// each archive is 7 bytes
+		dir := NewArchives(t, "application.log.4", "application.log.3", "application.log.2", "application.log.1")
+
+		transformer := RetentionTransformer{Parser: ShiftingNamer{}, MaxTotalSize: 20}
+
+		_, err := transformer.Transform(filepath.Join(dir, "application.log.1"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1", "application.log.2", "other.log.1"})
+	})
+
+	t.Run("combined limits", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := NewArchives(t, "application.log.4", "application.log.3", "application.log.2", "application.log.1")
+
+		transformer := RetentionTransformer{
+			Parser:       ShiftingNamer{},
+			MaxArchives:  3,
+			MaxAge:       150 * time.Minute,
+			MaxTotalSize: 100,
+			NowFunc:      func() time.Time { return testTime.Add(4 * time.Hour) },
+		}
+
+		_, err := transformer.Transform(filepath.Join(dir, "application.log.1"))
+		r.NoErr(err) // should not be any error
+		r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1", "application.log.2", "other.log.1"})
+	})
+}
+
+func TestRetentionTransformer_StartSweep(t *testing.T) {
+	t.Parallel()
+	r := is.New(t)
+
+	dir := SetupDir(t)
+	CleanupDir(t, dir)
+	NewFiles(t, dir, "archive", "application.log", "application.log.2", "application.log.1")
+
+	transformer := RetentionTransformer{Parser: ShiftingNamer{}, MaxArchives: 1}
+
+	stop := transformer.StartSweep(filepath.Join(dir, "application.log"), time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(DirFiles(t, dir)) != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+	stop() // stop should be idempotent
+
+	r.Equal(DirFiles(t, dir), []string{"application.log", "application.log.1"}) // sweep should remove archives in background
+}
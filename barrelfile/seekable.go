@@ -0,0 +1,298 @@
+package barrelfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// GzipIndexExt is the extension of the sidecar file holding the GzipIndex of a
+// seekable gzip archive, added to the name of the archive.
+const GzipIndexExt = ".idx"
+
+// gzipIndexMagic identifies the binary format of GzipIndex, followed by its
+// version.
+var gzipIndexMagic = [8]byte{'B', 'R', 'L', 'G', 'Z', 'I', 'D', 'X'}
+
+const gzipIndexVersion = 1
+
+// GzipIndex maps offsets within the uncompressed content of a seekable gzip
+// archive to the offsets of independently compressed blocks, which can be
+// decompressed without decompressing the preceding ones.
+type GzipIndex struct {
+	// Blocks of the archive, in order.
+	Blocks []GzipIndexBlock
+
+	// UncompressedSize is the total size of the uncompressed content.
+	UncompressedSize int64
+
+	// CompressedSize is the total size of the archive.
+	CompressedSize int64
+}
+
+// GzipIndexBlock describes a block of a seekable gzip archive.
+type GzipIndexBlock struct {
+	// UncompressedOffset of the first byte of the block in the uncompressed
+	// content.
+	UncompressedOffset int64
+
+	// CompressedOffset of the gzip member of the block in the archive.
+	CompressedOffset int64
+
+	// Time of the first record of the block. Zero if not recorded.
+	Time time.Time
+}
+
+// MarshalBinary encodes the index in its binary format, which is the magic
+// "BRLGZIDX", version, sizes, number of blocks, the blocks, each as its
+// offsets and time in unix nanoseconds (0 if not recorded), and a CRC-32 of
+// everything before it. All integers are big endian 64 bit, except version
+// and checksum which are 32 bit.
+func (x *GzipIndex) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(gzipIndexMagic[:])
+	_ = binary.Write(&buf, binary.BigEndian, uint32(gzipIndexVersion))
+	_ = binary.Write(&buf, binary.BigEndian, x.UncompressedSize)
+	_ = binary.Write(&buf, binary.BigEndian, x.CompressedSize)
+	_ = binary.Write(&buf, binary.BigEndian, int64(len(x.Blocks)))
+	for _, block := range x.Blocks {
+		var nanos int64
+		if !block.Time.IsZero() {
+			nanos = block.Time.UnixNano()
+		}
+		_ = binary.Write(&buf, binary.BigEndian, block.UncompressedOffset)
+		_ = binary.Write(&buf, binary.BigEndian, block.CompressedOffset)
+		_ = binary.Write(&buf, binary.BigEndian, nanos)
+	}
+	_ = binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the index from its binary format, as encoded by
+// MarshalBinary.
+func (x *GzipIndex) UnmarshalBinary(data []byte) error {
+	const headerSize, blockSize, checksumSize = 8 + 4 + 3*8, 3 * 8, 4
+	if len(data) < headerSize+checksumSize || !bytes.Equal(data[:8], gzipIndexMagic[:]) {
+		return fmt.Errorf("not a gzip index")
+	}
+	content, checksum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if crc32.ChecksumIEEE(content) != binary.BigEndian.Uint32(checksum) {
+		return fmt.Errorf("gzip index checksum mismatch")
+	}
+	if version := binary.BigEndian.Uint32(content[8:]); version != gzipIndexVersion {
+		return fmt.Errorf("unsupported gzip index version %d", version)
+	}
+	uncompressedSize := int64(binary.BigEndian.Uint64(content[12:]))
+	compressedSize := int64(binary.BigEndian.Uint64(content[20:]))
+	count := int64(binary.BigEndian.Uint64(content[28:]))
+	if count < 0 || int64(len(content)-headerSize) != count*blockSize {
+		return fmt.Errorf("gzip index size mismatch")
+	}
+	blocks := make([]GzipIndexBlock, count)
+	for i := range blocks {
+		b := content[headerSize+i*blockSize:]
+		blocks[i].UncompressedOffset = int64(binary.BigEndian.Uint64(b))
+		blocks[i].CompressedOffset = int64(binary.BigEndian.Uint64(b[8:]))
+		if nanos := int64(binary.BigEndian.Uint64(b[16:])); nanos != 0 {
+			blocks[i].Time = time.Unix(0, nanos)
+		}
+	}
+	x.Blocks = blocks
+	x.UncompressedSize = uncompressedSize
+	x.CompressedSize = compressedSize
+	return nil
+}
+
+// ReadGzipIndex reads the GzipIndex from the file at the given path.
+func ReadGzipIndex(path string) (*GzipIndex, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	index := &GzipIndex{}
+	if err := index.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("unmarshal gzip index: %w", err)
+	}
+	return index, nil
+}
+
+// WriteGzipIndex writes the GzipIndex to the file at the given path.
+func WriteGzipIndex(path string, index *GzipIndex, perm os.FileMode) error {
+	data, err := index.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("marshal gzip index: %w", err)
+	}
+	if err := ioutil.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	return nil
+}
+
+// SeekableGzipReader reads the uncompressed content of a seekable gzip archive,
+// as written by NewSeekableGzipWriter, and seeks within it using its GzipIndex,
+// decompressing only the blocks read.
+type SeekableGzipReader struct {
+	r      io.ReaderAt
+	index  *GzipIndex
+	closer io.Closer
+
+	pos   int64
+	block *gzip.Reader
+}
+
+var _ io.ReadSeeker = (*SeekableGzipReader)(nil)
+
+// NewSeekableGzipReader returns a SeekableGzipReader reading the archive from
+// r, using the given index.
+func NewSeekableGzipReader(r io.ReaderAt, index *GzipIndex) *SeekableGzipReader {
+	return &SeekableGzipReader{r: r, index: index}
+}
+
+// OpenSeekableGzip opens the seekable gzip archive at the given path, with its
+// index at path plus GzipIndexExt. The returned reader should be closed to
+// close the archive.
+func OpenSeekableGzip(path string) (*SeekableGzipReader, error) {
+	index, err := ReadGzipIndex(path + GzipIndexExt)
+	if err != nil {
+		return nil, fmt.Errorf("read gzip index: %w", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("os open: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("os stat: %w", err)
+	}
+	if stat.Size() != index.CompressedSize {
+		_ = file.Close()
+		return nil, fmt.Errorf("archive size does not match gzip index")
+	}
+	sr := NewSeekableGzipReader(file, index)
+	sr.closer = file
+	return sr, nil
+}
+
+// Read reads the uncompressed content from the current offset.
+func (sr *SeekableGzipReader) Read(p []byte) (int, error) {
+	for {
+		if sr.pos >= sr.index.UncompressedSize {
+			return 0, io.EOF
+		}
+		if sr.block == nil {
+			if err := sr.openBlock(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := sr.block.Read(p)
+		sr.pos += int64(n)
+		if errors.Is(err, io.EOF) {
+			sr.block = nil
+			err = nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("gzip read: %w", err)
+		}
+		if n > 0 || len(p) == 0 {
+			return n, nil
+		}
+	}
+}
+
+// Seek sets the offset within the uncompressed content for the next Read, as
+// io.Seeker. Seeking past the end is allowed, reads then return io.EOF.
+func (sr *SeekableGzipReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = sr.pos + offset
+	case io.SeekEnd:
+		pos = sr.index.UncompressedSize + offset
+	default:
+		return sr.pos, fmt.Errorf("invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return sr.pos, fmt.Errorf("negative offset")
+	}
+	if pos != sr.pos {
+		sr.pos = pos
+		sr.block = nil
+	}
+	return sr.pos, nil
+}
+
+// SeekTime seeks to the start of the last block whose first record is at or
+// before the given time, so that the following reads include all records from
+// the given time onwards, and returns the new offset. If the time is before
+// the first block, it seeks to the start.
+//
+// If the index does not record times of blocks then non-nil error is
+// returned.
+func (sr *SeekableGzipReader) SeekTime(t time.Time) (int64, error) {
+	pos := int64(0)
+	found := false
+	for _, block := range sr.index.Blocks {
+		if block.Time.IsZero() {
+			continue
+		}
+		found = true
+		if block.Time.After(t) {
+			break
+		}
+		pos = block.UncompressedOffset
+	}
+	if !found {
+		return sr.pos, fmt.Errorf("gzip index has no times")
+	}
+	return sr.Seek(pos, io.SeekStart)
+}
+
+// Close closes the archive, if opened by OpenSeekableGzip.
+func (sr *SeekableGzipReader) Close() error {
+	sr.block = nil
+	if sr.closer == nil {
+		return nil
+	}
+	if err := sr.closer.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	return nil
+}
+
+// openBlock opens the block containing the current offset, and skips to the
+// offset within it.
+func (sr *SeekableGzipReader) openBlock() error {
+	blocks := sr.index.Blocks
+	i := sort.Search(len(blocks), func(i int) bool {
+		return blocks[i].UncompressedOffset > sr.pos
+	}) - 1
+	if i < 0 {
+		return fmt.Errorf("no block at offset %d", sr.pos)
+	}
+	end := sr.index.CompressedSize
+	if i+1 < len(blocks) {
+		end = blocks[i+1].CompressedOffset
+	}
+	section := io.NewSectionReader(sr.r, blocks[i].CompressedOffset, end-blocks[i].CompressedOffset)
+	gzr, err := gzip.NewReader(section)
+	if err != nil {
+		return fmt.Errorf("gzip new reader: %w", err)
+	}
+	gzr.Multistream(false)
+	if _, err := io.CopyN(ioutil.Discard, gzr, sr.pos-blocks[i].UncompressedOffset); err != nil {
+		return fmt.Errorf("skip to offset: %w", err)
+	}
+	sr.block = gzr
+	return nil
+}
@@ -0,0 +1,208 @@
+package barrelfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestSeekableGzip(t *testing.T) {
+	t.Parallel()
+
+	// seekableLog returns log records, one per minute from testTime, and
+	// their seekable gzip compression with its index.
+	seekableLog := func(t *testing.T, records int) ([]byte, []byte, *GzipIndex) {
+		r := is.New(t)
+
+		var content bytes.Buffer
+		for i := 0; i < records; i++ {
+			ts := testTime.Add(time.Duration(i) * time.Minute).Format("2006-01-02 15:04:05")
+			fmt.Fprintf(&content, "[%s] record %d\n", ts, i)
+		}
+
+		var compressed bytes.Buffer
+		pw, err := NewSeekableGzipWriter(&compressed, gzip.DefaultCompression, 256, 4, "2006-01-02 15:04:05")
+		r.NoErr(err) // should not be any error
+		_, err = pw.Write(content.Bytes())
+		r.NoErr(err) // should not be any error
+		err = pw.Close()
+		r.NoErr(err) // should not be any error
+		return content.Bytes(), compressed.Bytes(), pw.Index()
+	}
+
+	t.Run("blocks are cut at records", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		content, compressed, index := seekableLog(t, 100)
+
+		r.True(len(index.Blocks) > 1)                         // content should be split in blocks
+		r.Equal(index.UncompressedSize, int64(len(content)))  // uncompressed size should be recorded
+		r.Equal(index.CompressedSize, int64(len(compressed))) // compressed size should be recorded
+		for _, block := range index.Blocks[1:] {
+			r.Equal(content[block.UncompressedOffset-1], byte('\n')) // block should start after a newline
+			r.True(!block.Time.IsZero())                             // block time should be recorded
+		}
+
+		gzr, err := gzip.NewReader(bytes.NewReader(compressed))
+		r.NoErr(err) // should not be any error
+		decompressed, err := ioutil.ReadAll(gzr)
+		r.NoErr(err)                               // should not be any error
+		r.True(bytes.Equal(decompressed, content)) // archive should be readable as plain gzip
+	})
+
+	t.Run("read from offsets", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		content, compressed, index := seekableLog(t, 100)
+		sr := NewSeekableGzipReader(bytes.NewReader(compressed), index)
+
+		all, err := ioutil.ReadAll(sr)
+		r.NoErr(err)                      // should not be any error
+		r.True(bytes.Equal(all, content)) // whole content should be read
+
+		for _, offset := range []int64{0, 1, 255, 256, 1000, int64(len(content)) - 1} {
+			pos, err := sr.Seek(offset, io.SeekStart)
+			r.NoErr(err)         // should not be any error
+			r.Equal(pos, offset) // offset should be set
+
+			rest, err := ioutil.ReadAll(sr)
+			r.NoErr(err)                                // should not be any error
+			r.True(bytes.Equal(rest, content[offset:])) // content from offset should be read
+		}
+
+		pos, err := sr.Seek(-10, io.SeekEnd)
+		r.NoErr(err) // should not be any error
+		r.Equal(pos, int64(len(content)-10))
+		rest, err := ioutil.ReadAll(sr)
+		r.NoErr(err)                                         // should not be any error
+		r.True(bytes.Equal(rest, content[len(content)-10:])) // content from end should be read
+
+		_, err = sr.Seek(-1, io.SeekStart)
+		r.True(err != nil) // should be non nil
+	})
+
+	t.Run("seek time", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, compressed, index := seekableLog(t, 100)
+		sr := NewSeekableGzipReader(bytes.NewReader(compressed), index)
+
+		_, err := sr.SeekTime(testTime.Add(50 * time.Minute))
+		r.NoErr(err) // should not be any error
+		rest, err := ioutil.ReadAll(sr)
+		r.NoErr(err) // should not be any error
+
+		want := fmt.Sprintf("[%s] record 50\n", testTime.Add(50*time.Minute).Format("2006-01-02 15:04:05"))
+		r.True(bytes.Contains(rest, []byte(want)))             // records from time should be read
+		r.True(!bytes.Contains(rest, []byte("] record 40\n"))) // records well before time should be skipped
+		r.True(strings.HasPrefix(string(rest), "["))           // reading should start at a record
+		r.True(len(rest) < int(index.UncompressedSize))        // preceding blocks should be skipped
+
+		pos, err := sr.SeekTime(testTime.Add(-time.Hour))
+		r.NoErr(err)           // should not be any error
+		r.Equal(pos, int64(0)) // time before first record should seek to start
+	})
+
+	t.Run("seek time without times", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		var compressed bytes.Buffer
+		pw, err := NewSeekableGzipWriter(&compressed, gzip.DefaultCompression, 0, 0, "")
+		r.NoErr(err) // should not be any error
+		_, err = pw.Write([]byte(testText))
+		r.NoErr(err) // should not be any error
+		err = pw.Close()
+		r.NoErr(err) // should not be any error
+
+		sr := NewSeekableGzipReader(bytes.NewReader(compressed.Bytes()), pw.Index())
+		_, err = sr.SeekTime(testTime)
+		r.True(err != nil) // should be non nil
+	})
+}
+
+func TestGzipIndex_MarshalBinary(t *testing.T) {
+	t.Parallel()
+	r := is.New(t)
+
+	index := &GzipIndex{
+		Blocks: []GzipIndexBlock{
+			{UncompressedOffset: 0, CompressedOffset: 0, Time: testTime},
+			{UncompressedOffset: 100, CompressedOffset: 40},
+		},
+		UncompressedSize: 150,
+		CompressedSize:   70,
+	}
+	data, err := index.MarshalBinary()
+	r.NoErr(err) // should not be any error
+
+	var decoded GzipIndex
+	err = decoded.UnmarshalBinary(data)
+	r.NoErr(err)                                              // should not be any error
+	r.Equal(decoded.UncompressedSize, index.UncompressedSize) // sizes should be decoded
+	r.Equal(decoded.CompressedSize, index.CompressedSize)     // sizes should be decoded
+	r.Equal(len(decoded.Blocks), 2)                           // blocks should be decoded
+	r.True(decoded.Blocks[0].Time.Equal(testTime))            // time should be decoded
+	r.True(decoded.Blocks[1].Time.IsZero())                   // missing time should be decoded
+	r.Equal(decoded.Blocks[1].CompressedOffset, int64(40))    // offsets should be decoded
+
+	err = decoded.UnmarshalBinary(data[:len(data)-1])
+	r.True(err != nil) // truncated index should be non nil error
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[20]++
+	err = decoded.UnmarshalBinary(corrupted)
+	r.True(err != nil) // corrupted index should be non nil error
+
+	err = decoded.UnmarshalBinary([]byte(testText))
+	r.True(err != nil) // other content should be non nil error
+}
+
+func TestGzipTransformer_Transform_Seekable(t *testing.T) {
+	t.Parallel()
+	r := is.New(t)
+
+	dir := SetupDir(t)
+	CleanupDir(t, dir)
+
+	content := gzipTestData(100000)
+	NewFiles(t, dir, string(content), "application.log")
+	file := filepath.Join(dir, "application.log")
+
+	transformer := GzipTransformer{GzipLevel: gzip.BestSpeed, BlockSize: 4096, Seekable: true}
+
+	path, err := transformer.Transform(file)
+	r.NoErr(err)              // should not be any error
+	r.Equal(path, file+".gz") // ".gz" extension should be added
+	r.Equal(DirFiles(t, dir), []string{"application.log.gz", "application.log.gz.idx"})
+
+	sr, err := OpenSeekableGzip(path)
+	r.NoErr(err) // should not be any error
+	defer func() { _ = sr.Close() }()
+
+	_, err = sr.Seek(50000, io.SeekStart)
+	r.NoErr(err) // should not be any error
+	rest, err := ioutil.ReadAll(sr)
+	r.NoErr(err)                               // should not be any error
+	r.True(bytes.Equal(rest, content[50000:])) // content from offset should be read
+
+	_, err = OpenSeekableGzip(filepath.Join(dir, "missing.log.gz"))
+	r.True(err != nil) // should be non nil
+
+	err = os.Truncate(path, 10)
+	r.NoErr(err) // should not be any error
+	_, err = OpenSeekableGzip(path)
+	r.True(err != nil) // archive not matching index should be non nil error
+}
@@ -0,0 +1,45 @@
+package barrelfile
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// startSweep runs sweep every interval in a separate goroutine, until the
+// returned stop function is called. Errors are logged to the logger, prefixed
+// with the given prefix.
+func startSweep(interval time.Duration, sweep func() error, logger *log.Logger, prefix string) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := sweep(); err != nil {
+					logf(logger, "%s: %v", prefix, err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+// logf logs to the logger, if it is not nil.
+func logf(logger *log.Logger, format string, v ...interface{}) {
+	if logger != nil {
+		logger.Printf(format, v...)
+	}
+}
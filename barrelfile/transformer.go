@@ -2,6 +2,7 @@ package barrelfile
 
 import (
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -20,6 +21,10 @@ type RenameTransformer struct {
 	// ForceMove forces the physical file move, even if inode rename is
 	// possible. Use carefully.
 	ForceMove bool
+
+	// MaxAttempts is the max number of names tried when the destination
+	// already exists. If unset, it will correspond to 100.
+	MaxAttempts int
 }
 
 // Transform renames/moves the file at the given path, to the destination as
@@ -31,24 +36,65 @@ type RenameTransformer struct {
 // operation. If ForceMove is set true, then inode rename is not even tried,
 // and more expensive operation of physically moving the file is performed.
 //
+// The destination is never overwritten. The file is linked at the
+// destination, and the destination is created exclusively while physically
+// moving the file, so if another process has taken the name in the meantime,
+// a new name is generated by the Namer, which then sees the taken name, and
+// the move is retried, up to MaxAttempts times.
+//
 // If there are any error while generating the new path or actually performing
 // the rename/move, then non-nil error is returned.
 func (t RenameTransformer) Transform(path string) (string, error) {
-	newPath, err := t.Namer.Name(path)
-	if err != nil {
-		return path, fmt.Errorf("namer new name: %w", err)
+	maxAttempts := t.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 100
 	}
-	if err := fileMove(path, newPath, t.ForceMove); err != nil {
-		return path, fmt.Errorf("rename: %w", err)
+	for attempt := 0; ; attempt++ {
+		newPath, err := t.Namer.Name(path)
+		if err != nil {
+			return path, fmt.Errorf("namer new name: %w", err)
+		}
+		err = fileMove(path, newPath, t.ForceMove)
+		if errors.Is(err, os.ErrExist) && attempt+1 < maxAttempts {
+			continue
+		}
+		if err != nil {
+			return path, fmt.Errorf("rename: %w", err)
+		}
+		return newPath, nil
 	}
-	return newPath, nil
 }
 
 // GzipTransformer compresses and converts file to gzip format.
+//
+// See CompressTransformer with GzipCodec for a transformer where unset level
+// corresponds to the default compression.
 type GzipTransformer struct {
 	// GzipLevel defines the gzip level used for compression. If unset (ie. 0),
 	// it will correspond to gzip.NoCompression.
 	GzipLevel int
+
+	// Concurrency is the number of goroutines compressing the file. If greater
+	// than 1, the file is compressed in blocks by a ParallelGzipWriter into a
+	// multi-member gzip file, otherwise it is compressed by a single gzip
+	// writer.
+	Concurrency int
+
+	// BlockSize is the size of blocks compressed concurrently, used only if
+	// Concurrency is greater than 1 or Seekable is set. If unset (ie. 0),
+	// DefaultGzipBlockSize is used.
+	BlockSize int
+
+	// Seekable compresses the file in independent blocks, and writes a
+	// GzipIndex of the blocks next to the archive, with GzipIndexExt added to
+	// its name. Such archives can be read from any offset with
+	// OpenSeekableGzip.
+	Seekable bool
+
+	// IndexTimeLayout is the layout of record timestamps, recorded in the
+	// GzipIndex for every block, allowing to seek by time. Used only if
+	// Seekable is set.
+	IndexTimeLayout string
 }
 
 // Transform compresses the file at the given path using gzip compression at
@@ -56,17 +102,58 @@ type GzipTransformer struct {
 // directory as the original file, but ".gz" extension is added to the file
 // name.
 //
-// If there are any error while compressing the file at given path then non-nil
-// error is returned.
+// If there are any error while compressing the file at given path, or the
+// compressed file already exists, then non-nil error is returned.
 func (t GzipTransformer) Transform(path string) (string, error) {
 	gzPath := fmt.Sprintf("%s.gz", path)
+	if t.Seekable {
+		var pw *ParallelGzipWriter
+		newWriter := func(w io.Writer) (io.WriteCloser, error) {
+			var err error
+			pw, err = NewSeekableGzipWriter(w, t.GzipLevel, t.BlockSize, t.Concurrency, t.IndexTimeLayout)
+			return pw, err
+		}
+		finish := func(mode os.FileMode) error {
+			return WriteGzipIndex(gzPath+GzipIndexExt, pw.Index(), mode)
+		}
+		if err := fileCompress(path, gzPath, newWriter, finish); err != nil {
+			return path, fmt.Errorf("seekable gzip: %w", err)
+		}
+		return gzPath, nil
+	}
+	if t.Concurrency > 1 {
+		err := fileCompress(path, gzPath, func(w io.Writer) (io.WriteCloser, error) {
+			return NewParallelGzipWriter(w, t.GzipLevel, t.BlockSize, t.Concurrency)
+		}, nil)
+		if err != nil {
+			return path, fmt.Errorf("parallel gzip: %w", err)
+		}
+		return gzPath, nil
+	}
 	if err := fileGzip(path, gzPath, t.GzipLevel); err != nil {
-		return path, fmt.Errorf("")
+		return path, fmt.Errorf("gzip: %w", err)
 	}
 	return gzPath, nil
 }
 
 func fileGzip(src, dst string, level int) error {
+	return fileCompress(src, dst, func(w io.Writer) (io.WriteCloser, error) {
+		gzw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, fmt.Errorf("gzip new writer level: %w", err)
+		}
+		return gzw, nil
+	}, nil)
+}
+
+// fileCompress compresses the file at src into the file at dst, using the
+// writer returned by newWriter, and removes the file at src. If finish is not
+// nil, it is called once the file at dst is complete, with its mode.
+//
+// The file at dst is created exclusively, so an existing file, eg. an archive
+// of a previous rotation given the same name, is never overwritten, and an
+// error wrapping os.ErrExist is returned instead.
+func fileCompress(src, dst string, newWriter func(w io.Writer) (io.WriteCloser, error), finish func(mode os.FileMode) error) error {
 	stat, err := os.Stat(src)
 	if err != nil && os.IsNotExist(err) {
 		return fmt.Errorf("no such file: %w", err)
@@ -82,45 +169,51 @@ func fileGzip(src, dst string, level int) error {
 		return fmt.Errorf("os open src file: %w", err)
 	}
 
-	gzFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, stat.Mode())
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, stat.Mode())
 	if err != nil {
 		_ = srcFile.Close()
-		return fmt.Errorf("os open gzip file: %w", err)
+		return fmt.Errorf("os open compressed file: %w", err)
 	}
-	gzw, err := gzip.NewWriterLevel(gzFile, level)
+	cw, err := newWriter(dstFile)
 	if err != nil {
-		_ = gzFile.Close()
+		_ = dstFile.Close()
 		_ = os.Remove(dst)
 		_ = srcFile.Close()
-		return fmt.Errorf("gzip new writer level: %w", err)
+		return fmt.Errorf("new compress writer: %w", err)
 	}
-	if _, err := io.Copy(gzw, srcFile); err != nil {
-		_ = gzw.Close()
-		_ = gzFile.Close()
+	if _, err := io.Copy(cw, srcFile); err != nil {
+		_ = cw.Close()
+		_ = dstFile.Close()
 		_ = os.Remove(dst)
 		_ = srcFile.Close()
-		return fmt.Errorf("copy and gzip compress: %w", err)
+		return fmt.Errorf("copy and compress: %w", err)
 	}
-	if err := gzw.Close(); err != nil {
-		_ = gzFile.Close()
+	if err := cw.Close(); err != nil {
+		_ = dstFile.Close()
 		_ = os.Remove(dst)
 		_ = srcFile.Close()
-		return fmt.Errorf("close gzip writer: %w", err)
+		return fmt.Errorf("close compress writer: %w", err)
 	}
-	if err := gzFile.Sync(); err != nil {
-		_ = gzFile.Close()
+	if err := dstFile.Sync(); err != nil {
+		_ = dstFile.Close()
 		_ = srcFile.Close()
-		return fmt.Errorf("sync gzip file: %w", err)
+		return fmt.Errorf("sync compressed file: %w", err)
 	}
-	if err := gzFile.Close(); err != nil {
+	if err := dstFile.Close(); err != nil {
 		_ = srcFile.Close()
-		return fmt.Errorf("close gzip file: %w", err)
+		return fmt.Errorf("close compressed file: %w", err)
 	}
 	if err := srcFile.Close(); err != nil {
 		return fmt.Errorf("close src file: %w", err)
 	}
 	if err := os.Chtimes(dst, stat.ModTime(), stat.ModTime()); err != nil {
-		return fmt.Errorf("os change times gzip file: %w", err)
+		return fmt.Errorf("os change times compressed file: %w", err)
+	}
+	if finish != nil {
+		if err := finish(stat.Mode()); err != nil {
+			_ = os.Remove(dst)
+			return fmt.Errorf("finish compressed file: %w", err)
+		}
 	}
 	if err := os.Remove(src); err != nil {
 		return fmt.Errorf("os remove src file: %w", err)
@@ -140,8 +233,9 @@ func fileMove(src, dst string, force bool) error {
 		return fmt.Errorf("src is path of a directory not a file")
 	}
 	if !force {
-		if err := inodeRename(src, dst); err == nil {
-			return nil
+		err := inodeRename(src, dst)
+		if err == nil || errors.Is(err, os.ErrExist) {
+			return err
 		}
 	}
 	if err := physicalMove(src, dst); err != nil {
@@ -150,9 +244,15 @@ func fileMove(src, dst string, force bool) error {
 	return nil
 }
 
+// inodeRename renames the inode by linking it at the destination and
+// unlinking the source, unlike os.Rename it fails with an error wrapping
+// os.ErrExist if the destination already exists.
 func inodeRename(src, dst string) error {
-	if err := os.Rename(src, dst); err != nil {
-		return fmt.Errorf("os rename inode: %w", err)
+	if err := os.Link(src, dst); err != nil {
+		return fmt.Errorf("os link inode: %w", err)
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("os remove src file: %w", err)
 	}
 	return nil
 }
@@ -166,7 +266,7 @@ func physicalMove(src, dst string) error {
 	if err != nil {
 		return fmt.Errorf("os open src file: %w", err)
 	}
-	dstFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, stat.Mode())
+	dstFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_EXCL, stat.Mode())
 	if err != nil {
 		_ = srcFile.Close()
 		return fmt.Errorf("os open dst file: %w", err)
@@ -174,11 +274,13 @@ func physicalMove(src, dst string) error {
 	if _, err := io.Copy(dstFile, srcFile); err != nil {
 		_ = srcFile.Close()
 		_ = dstFile.Close()
+		_ = os.Remove(dst)
 		return fmt.Errorf("io copy src to dst file: %w", err)
 	}
 	if err := dstFile.Sync(); err != nil {
 		_ = srcFile.Close()
 		_ = dstFile.Close()
+		_ = os.Remove(dst)
 		return fmt.Errorf("sync dst file: %w", err)
 	}
 	if err := dstFile.Close(); err != nil {
@@ -196,3 +298,31 @@ func physicalMove(src, dst string) error {
 	}
 	return nil
 }
+
+// CompressTransformer compresses the file with the provided Codec.
+type CompressTransformer struct {
+	// Codec used to compress the file, eg. GzipCodec or one looked up by
+	// name with LookupCodec.
+	Codec Codec
+}
+
+// Transform compresses the file at the given path using the provided Codec.
+// The resulting compressed file is created in the same directory as the
+// original file, with extension of the Codec added to the file name.
+//
+// If there are any error while compressing the file at given path, or the
+// compressed file already exists, or the Codec has no extension, then non-nil
+// error is returned.
+func (t CompressTransformer) Transform(path string) (string, error) {
+	if t.Codec == nil {
+		return path, fmt.Errorf("no codec")
+	}
+	if len(t.Codec.Ext()) == 0 {
+		return path, fmt.Errorf("codec %q has no extension", t.Codec.Name())
+	}
+	compressedPath := path + t.Codec.Ext()
+	if err := fileCompress(path, compressedPath, t.Codec.NewWriter, nil); err != nil {
+		return path, fmt.Errorf("compress %s: %w", t.Codec.Name(), err)
+	}
+	return compressedPath, nil
+}
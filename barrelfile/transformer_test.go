@@ -8,7 +8,10 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -161,6 +164,141 @@ func TestRenameTransformer_Transform(t *testing.T) {
 	})
 }
 
+func TestRenameTransformer_Transform_NoReplace(t *testing.T) {
+	t.Parallel()
+
+	t.Run("existing destination is not overwritten", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+		NewFiles(t, dir, "archive", "application.log.1")
+
+		for _, force := range []bool{false, true} {
+			transformer := RenameTransformer{Namer: fixedNamer(filepath.Join(dir, "application.log.1")), ForceMove: force, MaxAttempts: 3}
+
+			path, err := transformer.Transform(filepath.Join(dir, "application.log"))
+			r.True(errors.Is(err, os.ErrExist))                   // error should wrap os.ErrExist
+			r.True(path == filepath.Join(dir, "application.log")) // path returned should be same as given path
+
+			data, err := ioutil.ReadFile(filepath.Join(dir, "application.log.1"))
+			r.NoErr(err)                     // should not be any error
+			r.Equal(string(data), "archive") // existing destination should not be overwritten
+		}
+	})
+
+	t.Run("taken name is retried", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, "current", "application.log")
+		NewFiles(t, dir, "archive", "application.log.1")
+
+		names := []string{"application.log.1", "application.log.2"}
+		var calls int
+		transformer := RenameTransformer{Namer: &NamerMock{
+			NameFunc: func(_ string) (string, error) {
+				calls++
+				return filepath.Join(dir, names[calls-1]), nil
+			},
+		}}
+
+		path, err := transformer.Transform(filepath.Join(dir, "application.log"))
+		r.NoErr(err)                                           // should not be any error
+		r.Equal(path, filepath.Join(dir, "application.log.2")) // next name should be used
+		r.True(calls == 2)                                     // namer should be called again
+	})
+
+	t.Run("competing rotators", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		archiveDir := filepath.Join(dir, "archive")
+		pattern := filepath.Join(archiveDir, "{base}.{seq}{ext}")
+
+		// every rotator is a separate process, rotating its own files to the
+		// same archive directory.
+		const rotators, files = 4, 8
+		var wg sync.WaitGroup
+		outputs := make([][]byte, rotators)
+		errs := make([]error, rotators)
+		contents := make(map[string]string)
+		for i := 0; i < rotators; i++ {
+			var currents []string
+			for j := 0; j < files; j++ {
+				srcDir := filepath.Join(dir, fmt.Sprintf("src-%d-%d", i, j))
+				err := os.Mkdir(srcDir, 0755)
+				r.NoErr(err) // should not be any error
+				NewFiles(t, srcDir, fmt.Sprintf("rotator %d file %d", i, j), "application.log")
+				current := filepath.Join(srcDir, "application.log")
+				currents = append(currents, current)
+				contents[current] = fmt.Sprintf("rotator %d file %d", i, j)
+			}
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestRenameTransformerHelperProcess$")
+			cmd.Env = append(os.Environ(),
+				"BARREL_HELPER_PATTERN="+pattern,
+				"BARREL_HELPER_FILES="+strings.Join(currents, string(os.PathListSeparator)),
+			)
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				outputs[i], errs[i] = cmd.Output()
+			}(i)
+		}
+		wg.Wait()
+
+		seen := make(map[string]bool)
+		for i := 0; i < rotators; i++ {
+			r.NoErr(errs[i]) // should not be any error
+			for _, line := range strings.Split(strings.TrimSpace(string(outputs[i])), "\n") {
+				fields := strings.SplitN(line, "\t", 2)
+				r.Equal(len(fields), 2) // rotator should report current and new path
+				current, path := fields[0], fields[1]
+				r.True(!seen[path]) // each rotation should get a distinct name
+				seen[path] = true
+
+				data, err := ioutil.ReadFile(path)
+				r.NoErr(err)                             // should not be any error
+				r.Equal(string(data), contents[current]) // archive should not be overwritten
+			}
+		}
+		r.True(len(seen) == rotators*files)                    // all files should be rotated
+		r.True(len(DirFiles(t, archiveDir)) == rotators*files) // all archives should be present
+	})
+}
+
+// TestRenameTransformerHelperProcess is not a real test, it is run as a child
+// process by the competing rotators test, to rotate the files given in the
+// environment, and print their current and new paths.
+func TestRenameTransformerHelperProcess(t *testing.T) {
+	pattern := os.Getenv("BARREL_HELPER_PATTERN")
+	if len(pattern) == 0 {
+		return
+	}
+	namer, err := NewTemplateNamer(pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "new template namer: %v\n", err)
+		os.Exit(1)
+	}
+	transformer := RenameTransformer{Namer: namer}
+	for _, current := range filepath.SplitList(os.Getenv("BARREL_HELPER_FILES")) {
+		path, err := transformer.Transform(current)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "transform %s: %v\n", current, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s\t%s\n", current, path)
+	}
+	os.Exit(0)
+}
+
 func TestGzipTransformer_Transform(t *testing.T) {
 	t.Parallel()
 
@@ -280,4 +418,162 @@ func TestGzipTransformer_Transform(t *testing.T) {
 		r.NoErr(err)                                  // should not be any error
 		r.True(stat.ModTime().Equal(originalModTime)) // new file's mod time should be same as original one's
 	})
+
+	t.Run("transform file at path concurrently", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+
+		content := gzipTestData(100000)
+		NewFiles(t, dir, string(content), "application.log")
+		file := filepath.Join(dir, "application.log")
+
+		transformer := GzipTransformer{GzipLevel: gzip.BestSpeed, Concurrency: 4, BlockSize: 4096}
+
+		path, err := transformer.Transform(file)
+		r.NoErr(err)              // should not be any error
+		r.Equal(path, file+".gz") // ".gz" extension should be added
+
+		_, err = os.Stat(file)
+		r.True(os.IsNotExist(err)) // original file should not exist after transform
+
+		compressed, err := ioutil.ReadFile(path)
+		r.NoErr(err) // should not be any error
+		gzr, err := gzip.NewReader(bytes.NewReader(compressed))
+		r.NoErr(err) // should not be any error
+		decompressed, err := ioutil.ReadAll(gzr)
+		r.NoErr(err)                               // should not be any error
+		r.True(bytes.Equal(decompressed, content)) // decompressed content should be same as original
+	})
+}
+
+func TestCompressingTransformers_NoReplace(t *testing.T) {
+	t.Parallel()
+
+	keys := StaticKeyProvider{CurrentID: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+
+	for name, transformer := range map[string]Transformer{
+		"gzip":          GzipTransformer{},
+		"parallel gzip": GzipTransformer{Concurrency: 2},
+		"seekable gzip": GzipTransformer{Seekable: true},
+		"compress":      CompressTransformer{Codec: ZlibCodec{}},
+		"encrypt":       EncryptTransformer{Keys: keys},
+	} {
+		name, transformer := name, transformer
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			r := is.New(t)
+
+			dir := SetupDir(t)
+			CleanupDir(t, dir)
+			NewFiles(t, dir, testText, "application.log.1")
+			file := filepath.Join(dir, "application.log.1")
+
+			// output of the transformer, to be taken by an existing archive
+			path, err := transformer.Transform(file)
+			r.NoErr(err) // should not be any error
+			err = os.Rename(path, path+".tmp")
+			r.NoErr(err) // should not be any error
+			NewFiles(t, dir, "archive", filepath.Base(path))
+			NewFiles(t, dir, testText, "application.log.1")
+
+			newPath, err := transformer.Transform(file)
+			r.True(errors.Is(err, os.ErrExist)) // error should wrap os.ErrExist
+			r.Equal(newPath, file)              // path returned should be same as given path
+
+			data, err := ioutil.ReadFile(path)
+			r.NoErr(err)                     // should not be any error
+			r.Equal(string(data), "archive") // existing archive should not be overwritten
+			data, err = ioutil.ReadFile(file)
+			r.NoErr(err)                    // should not be any error
+			r.Equal(string(data), testText) // file should not be removed
+		})
+	}
+}
+
+func TestCompressTransformer_Transform(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no codec", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "compress-transformer-*")
+
+		path, err := CompressTransformer{}.Transform(file)
+		r.True(err != nil)   // should be non nil
+		r.True(path == file) // path returned should be same as given path
+	})
+
+	t.Run("no file at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		// Hopefully this is random
+		randomPath := filepath.Join(dir, "g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn")
+
+		path, err := CompressTransformer{Codec: ZlibCodec{}}.Transform(randomPath)
+		r.True(err != nil)         // should be non nil
+		r.True(path == randomPath) // path returned should be same as given path
+	})
+
+	t.Run("codec without extension", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, testText, "application.log")
+		file := filepath.Join(dir, "application.log")
+
+		path, err := CompressTransformer{Codec: ExecCodec{CodecName: "cat", Compress: []string{"cat"}}}.Transform(file)
+		r.True(err != nil)   // should be non nil
+		r.True(path == file) // path returned should be same as given path
+
+		data, err := ioutil.ReadFile(file)
+		r.NoErr(err)                    // should not be any error
+		r.Equal(string(data), testText) // file should not be lost
+	})
+
+	for _, codec := range []Codec{GzipCodec{}, ZlibCodec{}, DeflateCodec{}} {
+		codec := codec
+		t.Run(fmt.Sprintf("transform file at path with %s", codec.Name()), func(t *testing.T) {
+			t.Parallel()
+			r := is.New(t)
+
+			dir := SetupDir(t)
+			CleanupDir(t, dir)
+			NewFiles(t, dir, testText, "application.log")
+
+			file := filepath.Join(dir, "application.log")
+			err := os.Chtimes(file, testTime, testTime)
+			r.NoErr(err) // should not be any error
+
+			path, err := CompressTransformer{Codec: codec}.Transform(file)
+			r.NoErr(err)                    // should not be any error
+			r.Equal(path, file+codec.Ext()) // codec extension should be added
+
+			_, err = os.Stat(file)
+			r.True(os.IsNotExist(err)) // original file should not exist after transform
+
+			compressed, err := os.Open(path)
+			r.NoErr(err) // should not be any error
+			defer func() { _ = compressed.Close() }()
+			rd, err := codec.NewReader(compressed)
+			r.NoErr(err) // should not be any error
+			content, err := ioutil.ReadAll(rd)
+			r.NoErr(err)                       // should not be any error
+			r.Equal(string(content), testText) // decompressed content should be same as original
+
+			stat, err := os.Stat(path)
+			r.NoErr(err)                           // should not be any error
+			r.True(stat.ModTime().Equal(testTime)) // compressed file's mod time should be same as original one's
+		})
+	}
 }
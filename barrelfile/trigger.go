@@ -1,8 +1,14 @@
 package barrelfile
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,6 +29,11 @@ type Trigger interface {
 type SizeBasedTrigger struct {
 	// Max size of file.
 	Size int64
+
+	// Uncompressed limits the uncompressed size of a CompressedFile, instead
+	// of the size of the compressed file on disk. It has effect only when
+	// triggered through TriggerAdapter.
+	Uncompressed bool
 }
 
 var _ Trigger = (*SizeBasedTrigger)(nil)
@@ -56,6 +67,24 @@ func (t SizeBasedTrigger) Trigger(path string, p []byte) (bool, error) {
 	return true, nil
 }
 
+// triggerCompressedFile returns true if uncompressed size of the file plus size
+// of bytes to be written exceeds the max size provided, when limiting the
+// Uncompressed size. Otherwise it triggers on the size of the file on disk,
+// which only includes the bytes flushed by the compressor.
+func (t SizeBasedTrigger) triggerCompressedFile(file *CompressedFile, p []byte) (bool, error) {
+	if !t.Uncompressed {
+		return t.Trigger(file.Name(), p)
+	}
+	writeSize := int64(len(p))
+	if writeSize > t.Size {
+		return false, fmt.Errorf("write size greater than max file size")
+	}
+	if file.Size()+writeSize < t.Size {
+		return false, nil
+	}
+	return true, nil
+}
+
 // CronBasedTrigger describes a trigger which works on mod time of the file.
 type CronBasedTrigger struct {
 	// CronExpression describes the rotation schedule.
@@ -123,3 +152,467 @@ func (t *CronBasedTrigger) Trigger(path string, _ []byte) (bool, error) {
 	}
 	return rotate, nil
 }
+
+// LineBasedTrigger describes a trigger which works on number of records in the
+// file, where records are delimited by the given Delimiter.
+type LineBasedTrigger struct {
+	// Max number of records in the file.
+	Lines int64
+
+	// Delimiter separating the records. If unset (ie. 0), it will correspond
+	// to '\n'.
+	Delimiter byte
+
+	count       int64
+	initialized bool
+	mu          sync.Mutex
+}
+
+var _ Trigger = (*LineBasedTrigger)(nil)
+
+// Trigger counts the records in the given bytes, and returns true if number
+// of records already in the file plus records in bytes to be written exceeds
+// the max number of records provided, otherwise it returns false.
+//
+// On first use the records already present in the file at given path are
+// counted by scanning the file. Afterwards count is maintained from the bytes
+// passed to Trigger, and is reset whenever the trigger returns true, as the
+// bytes are then written to the rotated file. For a CompressedFile, triggered
+// through TriggerAdapter, the records are counted in the decompressed file.
+//
+// If there is any error while scanning the file, or if the given path is not
+// a path to a file, or the given bytes contain more records than max number of
+// records then non-nil error is returned.
+func (t *LineBasedTrigger) Trigger(path string, p []byte) (bool, error) {
+	delim := t.delimiter()
+	return t.trigger(p, func() (int64, error) {
+		return fileCountDelim(path, delim)
+	})
+}
+
+// triggerCompressedFile is Trigger for the file, except that on first use the
+// records already present are counted by decompressing the file.
+func (t *LineBasedTrigger) triggerCompressedFile(file *CompressedFile, p []byte) (bool, error) {
+	return t.trigger(p, func() (int64, error) {
+		// written bytes are readable only once flushed.
+		if err := file.Flush(); err != nil {
+			return 0, err
+		}
+		counter := delimCounter{delim: t.delimiter()}
+		if _, err := decompressFile(file.Name(), file.Codec(), &counter); err != nil {
+			return 0, err
+		}
+		return counter.count, nil
+	})
+}
+
+// trigger counts the records in the given bytes, initializing the count with
+// the records already present, as counted by the given function, on first use.
+func (t *LineBasedTrigger) trigger(p []byte, count func() (int64, error)) (bool, error) {
+	delim := t.delimiter()
+	writeLines := int64(bytes.Count(p, []byte{delim}))
+	if writeLines > t.Lines {
+		return false, fmt.Errorf("write lines greater than max file lines")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.initialized {
+		initial, err := count()
+		if err != nil {
+			return false, err
+		}
+		t.count = initial
+		t.initialized = true
+	}
+
+	if t.count+writeLines <= t.Lines {
+		t.count += writeLines
+		return false, nil
+	}
+	t.count = writeLines
+	return true, nil
+}
+
+func (t *LineBasedTrigger) delimiter() byte {
+	if t.Delimiter == 0 {
+		return '\n'
+	}
+	return t.Delimiter
+}
+
+// delimCounter counts the delimiters in the bytes written to it.
+type delimCounter struct {
+	delim byte
+	count int64
+}
+
+func (c *delimCounter) Write(p []byte) (int, error) {
+	c.count += int64(bytes.Count(p, []byte{c.delim}))
+	return len(p), nil
+}
+
+func fileCountDelim(path string, delim byte) (int64, error) {
+	stat, err := os.Stat(path)
+	if err != nil && os.IsNotExist(err) {
+		return 0, fmt.Errorf("no such file: %w", err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("os stat: %w", err)
+	}
+	if stat.IsDir() {
+		return 0, fmt.Errorf("path is of a directory not a file")
+	}
+	file, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, fmt.Errorf("os open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var count int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := file.Read(buf)
+		count += int64(bytes.Count(buf[:n], []byte{delim}))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read file: %w", err)
+		}
+	}
+	return count, nil
+}
+
+// AgeBasedTrigger describes a trigger which works on age of the file, measured
+// from when the file was created or first written.
+type AgeBasedTrigger struct {
+	// MaxAge of the file.
+	MaxAge time.Duration
+
+	// StatePath is the path of the file used to persist the creation time of
+	// the file when the platform or file system does not report birth time.
+	// If unset, it will correspond to ".<name>.created" in the directory of the
+	// file.
+	StatePath string
+
+	// NowFunc to wrap stdlib time.Now for testing.
+	NowFunc func() time.Time
+
+	// birthTimeFunc to wrap fileBirthTime for testing.
+	birthTimeFunc func(path string) (time.Time, error)
+
+	createdAt   time.Time
+	persist     bool
+	initialized bool
+	mu          sync.Mutex
+}
+
+var _ Trigger = (*AgeBasedTrigger)(nil)
+
+// Trigger returns true when the time elapsed since the file at the given path
+// was created exceeds the provided MaxAge, otherwise it returns false.
+//
+// On first use the creation time is determined once. An empty file is
+// considered to be created at the first write. Otherwise the birth time
+// reported by the file system (statx(2) on Linux) is used, and where it is not
+// available the time persisted at StatePath is used, falling back to mtime of
+// the file. In the fallback case the creation time is persisted at StatePath,
+// including on every rotation, so that it survives restarts of the process.
+//
+// If there is any error while checking file stat, or if the given path is not
+// a path to a file, or the creation time cannot be persisted then non-nil
+// error is returned.
+func (t *AgeBasedTrigger) Trigger(path string, _ []byte) (bool, error) {
+	var nowTime time.Time
+	if t.NowFunc != nil {
+		nowTime = t.NowFunc()
+	} else {
+		nowTime = time.Now()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.initialized {
+		if err := t.init(path, nowTime); err != nil {
+			return false, err
+		}
+		t.initialized = true
+	}
+
+	if nowTime.Sub(t.createdAt) < t.MaxAge {
+		return false, nil
+	}
+	// creation time is updated only once persisted, so that the rotation is
+	// retried if persisting fails.
+	if t.persist {
+		if err := t.writeState(path, nowTime); err != nil {
+			return false, err
+		}
+	}
+	t.createdAt = nowTime
+	return true, nil
+}
+
+func (t *AgeBasedTrigger) init(path string, nowTime time.Time) error {
+	stat, err := os.Stat(path)
+	if err != nil && os.IsNotExist(err) {
+		return fmt.Errorf("no such file: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("os stat: %w", err)
+	}
+	if stat.IsDir() {
+		return fmt.Errorf("path is of a directory not a file")
+	}
+
+	birthTime := t.birthTimeFunc
+	if birthTime == nil {
+		birthTime = fileBirthTime
+	}
+	createdAt, err := birthTime(path)
+	if err == nil {
+		t.createdAt = createdAt
+		if stat.Size() == 0 {
+			t.createdAt = nowTime
+		}
+		return nil
+	}
+
+	t.persist = true
+	createdAt, err = t.readState(path)
+	switch {
+	case err == nil:
+		t.createdAt = createdAt
+	case stat.Size() == 0:
+		t.createdAt = nowTime
+	default:
+		t.createdAt = stat.ModTime()
+	}
+	return t.writeState(path, t.createdAt)
+}
+
+func (t *AgeBasedTrigger) statePath(path string) string {
+	if len(t.StatePath) != 0 {
+		return t.StatePath
+	}
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.created", filepath.Base(path)))
+}
+
+func (t *AgeBasedTrigger) readState(path string) (time.Time, error) {
+	data, err := ioutil.ReadFile(t.statePath(path))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read state file: %w", err)
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse state file: %w", err)
+	}
+	return createdAt, nil
+}
+
+func (t *AgeBasedTrigger) writeState(path string, createdAt time.Time) error {
+	data := []byte(createdAt.Format(time.RFC3339Nano) + "\n")
+	if err := ioutil.WriteFile(t.statePath(path), data, 0644); err != nil {
+		return fmt.Errorf("write state file: %w", err)
+	}
+	return nil
+}
+
+// DiskSpaceBasedTrigger describes a trigger which works on free space of the
+// file system containing the file.
+type DiskSpaceBasedTrigger struct {
+	// MinFree is the number of bytes which should remain available on the
+	// file system.
+	MinFree uint64
+
+	// CheckInterval rate limits the checks of free space. If unset, it will
+	// correspond to 5 seconds.
+	CheckInterval time.Duration
+
+	// OnLowSpace is called, if set, when free space drops below MinFree,
+	// before rotation is triggered. It can be used to prune old archives.
+	OnLowSpace func(path string, free uint64) error
+
+	// NowFunc to wrap stdlib time.Now for testing.
+	NowFunc func() time.Time
+
+	// diskFreeFunc to wrap diskFree for testing.
+	diskFreeFunc func(path string) (uint64, error)
+
+	checkedAt time.Time
+}
+
+var _ Trigger = (*DiskSpaceBasedTrigger)(nil)
+
+// Trigger checks the free space of the file system containing the file at the
+// given path, at most once per CheckInterval, and returns true if free space
+// is below MinFree and the file is not empty, so that rotation can run the
+// configured compression and retention. Otherwise it returns false.
+//
+// Whenever free space is found below MinFree, OnLowSpace is called before
+// returning.
+//
+// If there is any error while checking file stat or free space, or if the
+// given path is not a path to a file, or OnLowSpace fails then non-nil error
+// is returned.
+func (t *DiskSpaceBasedTrigger) Trigger(path string, _ []byte) (bool, error) {
+	var nowTime time.Time
+	if t.NowFunc != nil {
+		nowTime = t.NowFunc()
+	} else {
+		nowTime = time.Now()
+	}
+	interval := t.CheckInterval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	if !t.checkedAt.IsZero() && nowTime.Sub(t.checkedAt) < interval {
+		return false, nil
+	}
+	t.checkedAt = nowTime
+
+	stat, err := os.Stat(path)
+	if err != nil && os.IsNotExist(err) {
+		return false, fmt.Errorf("no such file: %w", err)
+	}
+	if err != nil {
+		return false, fmt.Errorf("os stat: %w", err)
+	}
+	if stat.IsDir() {
+		return false, fmt.Errorf("path is of a directory not a file")
+	}
+
+	freeFunc := t.diskFreeFunc
+	if freeFunc == nil {
+		freeFunc = diskFree
+	}
+	free, err := freeFunc(filepath.Dir(path))
+	if err != nil {
+		return false, fmt.Errorf("disk free: %w", err)
+	}
+	if free >= t.MinFree {
+		return false, nil
+	}
+	if t.OnLowSpace != nil {
+		if err := t.OnLowSpace(path, free); err != nil {
+			return false, fmt.Errorf("on low space: %w", err)
+		}
+	}
+	return stat.Size() > 0, nil
+}
+
+// SentinelTrigger describes a trigger which works on presence of a sentinel
+// file, allowing external tools to request rotation.
+type SentinelTrigger struct {
+	// SentinelPath is the path of the sentinel file. If unset, it will
+	// correspond to path of the file with ".rotate" suffix.
+	SentinelPath string
+}
+
+var _ Trigger = (*SentinelTrigger)(nil)
+
+// Trigger returns true if the sentinel file exists, and removes the sentinel
+// file, otherwise it returns false.
+//
+// If there is any error while checking or removing the sentinel file then
+// non-nil error is returned.
+func (t SentinelTrigger) Trigger(path string, _ []byte) (bool, error) {
+	sentinelPath := t.SentinelPath
+	if len(sentinelPath) == 0 {
+		sentinelPath = fmt.Sprintf("%s.rotate", path)
+	}
+	_, err := os.Stat(sentinelPath)
+	if err != nil && os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("os stat sentinel: %w", err)
+	}
+	if err := os.Remove(sentinelPath); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("os remove sentinel: %w", err)
+	}
+	return true, nil
+}
+
+// MarkerTrigger describes a trigger which works on contents of the bytes
+// being written, so that a file can start with a particular record.
+type MarkerTrigger struct {
+	// Pattern matched against the bytes to be written.
+	Pattern *regexp.Regexp
+
+	// Marker searched in the bytes to be written.
+	Marker []byte
+}
+
+var _ Trigger = (*MarkerTrigger)(nil)
+
+// Trigger returns true if the bytes to be written match the provided Pattern
+// or contain the provided Marker, and the file at the given path is not empty,
+// otherwise it returns false.
+//
+// If there is any error while checking file stat, or if the given path is not
+// a path to a file then non-nil error is returned.
+func (t MarkerTrigger) Trigger(path string, p []byte) (bool, error) {
+	match := (t.Pattern != nil && t.Pattern.Match(p)) ||
+		(len(t.Marker) != 0 && bytes.Contains(p, t.Marker))
+	if !match {
+		return false, nil
+	}
+	stat, err := os.Stat(path)
+	if err != nil && os.IsNotExist(err) {
+		return false, fmt.Errorf("no such file: %w", err)
+	}
+	if err != nil {
+		return false, fmt.Errorf("os stat: %w", err)
+	}
+	if stat.IsDir() {
+		return false, fmt.Errorf("path is of a directory not a file")
+	}
+	return stat.Size() > 0, nil
+}
+
+// NotIfEmptyTrigger wraps a trigger, so that empty files are never rotated,
+// like notifempty of logrotate.
+type NotIfEmptyTrigger struct {
+	// FileTrigger determining the rotation of non-empty files.
+	FileTrigger Trigger
+}
+
+var _ Trigger = (*NotIfEmptyTrigger)(nil)
+
+// Trigger triggers the underlying FileTrigger, and returns its value if the
+// file at the given path is not empty, otherwise it returns false. The
+// underlying FileTrigger is triggered for empty files as well, so that
+// triggers keeping state, eg. a schedule, do not fall behind.
+//
+// If there is any error from underlying FileTrigger, or while checking file
+// stat, then non-nil error is returned.
+func (t NotIfEmptyTrigger) Trigger(path string, p []byte) (bool, error) {
+	rotate, err := t.FileTrigger.Trigger(path, p)
+	if err != nil || !rotate {
+		return false, err
+	}
+	stat, err := statFile(path)
+	if err != nil {
+		return false, err
+	}
+	return stat.Size() > 0, nil
+}
+
+// triggerCompressedFile triggers the underlying FileTrigger for the file, and
+// returns its value if the uncompressed size of the file is not zero, as the
+// compressed file is not empty even without any bytes written.
+func (t NotIfEmptyTrigger) triggerCompressedFile(file *CompressedFile, p []byte) (bool, error) {
+	var rotate bool
+	var err error
+	if ct, ok := t.FileTrigger.(compressedFileTrigger); ok {
+		rotate, err = ct.triggerCompressedFile(file, p)
+	} else {
+		rotate, err = t.FileTrigger.Trigger(file.Name(), p)
+	}
+	if err != nil || !rotate {
+		return false, err
+	}
+	return file.Size() > 0, nil
+}
@@ -1,8 +1,12 @@
 package barrelfile
 
 import (
+	"errors"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -206,6 +210,649 @@ func TestCronBasedTrigger_Trigger(t *testing.T) {
 	})
 }
 
+func TestLineBasedTrigger_Trigger(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no file at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		trigger := LineBasedTrigger{Lines: 10}
+
+		// Hopefully this is random
+		randomPath := filepath.Join(dir, "g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn")
+
+		v, err := trigger.Trigger(randomPath, nil)
+		r.True(err != nil)
+		r.True(v == false)
+	})
+
+	t.Run("initialization is retried after error", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		file := filepath.Join(dir, "application.log")
+
+		trigger := LineBasedTrigger{Lines: 3}
+
+		v, err := trigger.Trigger(file, nil)
+		r.True(err != nil) // should be non nil
+		r.True(v == false) // trigger should return false
+
+		NewFiles(t, dir, "a\nb\n", "application.log")
+
+		v, err = trigger.Trigger(file, []byte("c\nd\n"))
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // records already in file should be counted
+	})
+
+	t.Run("directory at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		trigger := LineBasedTrigger{Lines: 10}
+
+		v, err := trigger.Trigger(dir, nil)
+		r.True(err != nil)
+		r.True(v == false)
+	})
+
+	t.Run("write lines greater than max lines", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "line-based-trigger-*")
+
+		trigger := LineBasedTrigger{Lines: 1}
+
+		v, err := trigger.Trigger(file, []byte("hello\nworld\n"))
+		r.True(err != nil)
+		r.True(v == false)
+	})
+
+	t.Run("existing lines are counted on first use", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "line-based-trigger-*")
+		err := ioutil.WriteFile(file, []byte("one\ntwo\nthree\n"), 0644)
+		r.NoErr(err) // should not be any error
+
+		trigger := LineBasedTrigger{Lines: 4}
+
+		v, err := trigger.Trigger(file, []byte("four\n"))
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+
+		v, err = trigger.Trigger(file, []byte("five\n"))
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+	})
+
+	t.Run("custom delimiter", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "line-based-trigger-*")
+
+		trigger := LineBasedTrigger{Lines: 2, Delimiter: 0x1e}
+
+		v, err := trigger.Trigger(file, []byte("one\x1etwo\x1e"))
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+
+		v, err = trigger.Trigger(file, []byte("three\nstill three\n"))
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false, no delimiters written
+
+		v, err = trigger.Trigger(file, []byte("three\x1e"))
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+	})
+
+	t.Run("count resets after rotation", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "line-based-trigger-*")
+
+		trigger := LineBasedTrigger{Lines: 2}
+
+		for _, want := range []bool{false, false, true, false, true} {
+			v, err := trigger.Trigger(file, []byte("record\n"))
+			r.NoErr(err)      // should not be any error
+			r.True(v == want) // trigger should return expected value
+		}
+	})
+}
+
+func TestAgeBasedTrigger_Trigger(t *testing.T) {
+	t.Parallel()
+
+	noBirthTime := func(_ string) (time.Time, error) {
+		return time.Time{}, errors.New("birth time not reported")
+	}
+
+	t.Run("no file at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		trigger := AgeBasedTrigger{MaxAge: time.Hour}
+
+		// Hopefully this is random
+		randomPath := filepath.Join(dir, "g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn")
+
+		v, err := trigger.Trigger(randomPath, nil)
+		r.True(err != nil)
+		r.True(v == false)
+	})
+
+	t.Run("directory at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		trigger := AgeBasedTrigger{MaxAge: time.Hour}
+
+		v, err := trigger.Trigger(dir, nil)
+		r.True(err != nil)
+		r.True(v == false)
+	})
+
+	t.Run("file younger than max age", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "age-based-trigger-*")
+		err := ioutil.WriteFile(file, []byte("hello world"), 0644)
+		r.NoErr(err) // should not be any error
+
+		trigger := AgeBasedTrigger{
+			MaxAge:        time.Hour,
+			birthTimeFunc: func(_ string) (time.Time, error) { return testTime, nil },
+			NowFunc:       func() time.Time { return testTime.Add(30 * time.Minute) },
+		}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+	})
+
+	t.Run("file older than max age", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "age-based-trigger-*")
+		err := ioutil.WriteFile(file, []byte("hello world"), 0644)
+		r.NoErr(err) // should not be any error
+
+		clk := clock{}
+		clk.Set(testTime.Add(2 * time.Hour))
+
+		trigger := AgeBasedTrigger{
+			MaxAge:        time.Hour,
+			birthTimeFunc: func(_ string) (time.Time, error) { return testTime, nil },
+			NowFunc:       clk.Now,
+		}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+
+		// new file is younger than max age
+		clk.Set(testTime.Add(150 * time.Minute))
+
+		v, err = trigger.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+	})
+
+	t.Run("empty file is aged from first write", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "age-based-trigger-*")
+
+		clk := clock{}
+		clk.Set(testTime.Add(48 * time.Hour))
+
+		trigger := AgeBasedTrigger{
+			MaxAge:        time.Hour,
+			birthTimeFunc: func(_ string) (time.Time, error) { return testTime, nil },
+			NowFunc:       clk.Now,
+		}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+
+		clk.Set(testTime.Add(50 * time.Hour))
+
+		v, err = trigger.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+	})
+
+	t.Run("creation time is persisted without birth time", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "age-based-trigger-*")
+		statePath := filepath.Join(dir, "state")
+		t.Cleanup(func() {
+			err := os.Remove(statePath)
+			r.NoErr(err) // should not be any error
+		})
+
+		trigger := AgeBasedTrigger{
+			MaxAge:        time.Hour,
+			StatePath:     statePath,
+			birthTimeFunc: noBirthTime,
+			NowFunc:       func() time.Time { return testTime },
+		}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+
+		err = ioutil.WriteFile(file, []byte("hello world"), 0644)
+		r.NoErr(err) // should not be any error
+
+		// process restarts later
+		restarted := AgeBasedTrigger{
+			MaxAge:        time.Hour,
+			StatePath:     statePath,
+			birthTimeFunc: noBirthTime,
+			NowFunc:       func() time.Time { return testTime.Add(90 * time.Minute) },
+		}
+
+		v, err = restarted.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+
+		data, err := ioutil.ReadFile(statePath)
+		r.NoErr(err) // should not be any error
+		r.Equal(strings.TrimSpace(string(data)), testTime.Add(90*time.Minute).Format(time.RFC3339Nano))
+	})
+
+	t.Run("rotation is retried when creation time cannot be persisted", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "age-based-trigger-*")
+		statePath := filepath.Join(dir, "state")
+		t.Cleanup(func() {
+			err := os.Remove(statePath)
+			r.NoErr(err) // should not be any error
+		})
+
+		clk := clock{}
+		clk.Set(testTime)
+
+		trigger := AgeBasedTrigger{
+			MaxAge:        time.Hour,
+			StatePath:     statePath,
+			birthTimeFunc: noBirthTime,
+			NowFunc:       clk.Now,
+		}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+
+		// state cannot be written to a directory
+		trigger.StatePath = dir
+		clk.Set(testTime.Add(90 * time.Minute))
+
+		v, err = trigger.Trigger(file, nil)
+		r.True(err != nil) // should be non nil
+		r.True(v == false) // trigger should return false
+
+		trigger.StatePath = statePath
+
+		v, err = trigger.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // rotation should not be skipped
+	})
+}
+
+func TestDiskSpaceBasedTrigger_Trigger(t *testing.T) {
+	t.Parallel()
+
+	fixedFree := func(free uint64) func(string) (uint64, error) {
+		return func(_ string) (uint64, error) {
+			return free, nil
+		}
+	}
+
+	t.Run("no file at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		trigger := DiskSpaceBasedTrigger{MinFree: 100, diskFreeFunc: fixedFree(10)}
+
+		// Hopefully this is random
+		randomPath := filepath.Join(dir, "g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn")
+
+		v, err := trigger.Trigger(randomPath, nil)
+		r.True(err != nil)
+		r.True(v == false)
+	})
+
+	t.Run("directory at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		trigger := DiskSpaceBasedTrigger{MinFree: 100, diskFreeFunc: fixedFree(10)}
+
+		v, err := trigger.Trigger(dir, nil)
+		r.True(err != nil)
+		r.True(v == false)
+	})
+
+	t.Run("enough free space", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "disk-space-based-trigger-*")
+		err := ioutil.WriteFile(file, []byte("hello world"), 0644)
+		r.NoErr(err) // should not be any error
+
+		trigger := DiskSpaceBasedTrigger{MinFree: 1}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+	})
+
+	t.Run("low free space", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "disk-space-based-trigger-*")
+		err := ioutil.WriteFile(file, []byte("hello world"), 0644)
+		r.NoErr(err) // should not be any error
+
+		var lowSpaceCalls int
+		trigger := DiskSpaceBasedTrigger{
+			MinFree:      100,
+			diskFreeFunc: fixedFree(10),
+			OnLowSpace: func(path string, free uint64) error {
+				lowSpaceCalls++
+				return nil
+			},
+		}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)               // should not be any error
+		r.True(v == true)          // trigger should return true
+		r.True(lowSpaceCalls == 1) // low space hook should be called
+	})
+
+	t.Run("low free space and empty file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "disk-space-based-trigger-*")
+
+		trigger := DiskSpaceBasedTrigger{MinFree: 100, diskFreeFunc: fixedFree(10)}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false, nothing to rotate
+	})
+
+	t.Run("faulty low space hook", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "disk-space-based-trigger-*")
+
+		trigger := DiskSpaceBasedTrigger{
+			MinFree:      100,
+			diskFreeFunc: fixedFree(10),
+			OnLowSpace: func(_ string, _ uint64) error {
+				return errTrigger
+			},
+		}
+
+		v, err := trigger.Trigger(file, nil)
+		r.True(errors.Is(err, errTrigger)) // error should wrap low space hook error
+		r.True(v == false)
+	})
+
+	t.Run("checks are rate limited", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "disk-space-based-trigger-*")
+		err := ioutil.WriteFile(file, []byte("hello world"), 0644)
+		r.NoErr(err) // should not be any error
+
+		clk := clock{}
+		clk.Set(testTime)
+
+		var checks int
+		trigger := DiskSpaceBasedTrigger{
+			MinFree:       100,
+			CheckInterval: time.Minute,
+			NowFunc:       clk.Now,
+			diskFreeFunc: func(_ string) (uint64, error) {
+				checks++
+				return 10, nil
+			},
+		}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+
+		clk.Set(testTime.Add(30 * time.Second))
+
+		v, err = trigger.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false, within check interval
+
+		clk.Set(testTime.Add(2 * time.Minute))
+
+		v, err = trigger.Trigger(file, nil)
+		r.NoErr(err)        // should not be any error
+		r.True(v == true)   // trigger should return true
+		r.True(checks == 2) // free space should be checked once per interval
+	})
+}
+
+func TestSentinelTrigger_Trigger(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no sentinel file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "sentinel-trigger-*")
+
+		trigger := SentinelTrigger{}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+	})
+
+	t.Run("default sentinel file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "sentinel-trigger-*")
+		err := ioutil.WriteFile(file+".rotate", nil, 0644)
+		r.NoErr(err) // should not be any error
+
+		trigger := SentinelTrigger{}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+
+		_, err = os.Stat(file + ".rotate")
+		r.True(os.IsNotExist(err)) // sentinel file should be removed
+
+		v, err = trigger.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+	})
+
+	t.Run("custom sentinel file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "sentinel-trigger-*")
+		sentinel := filepath.Join(dir, "rotate-now")
+		err := ioutil.WriteFile(sentinel, nil, 0644)
+		r.NoErr(err) // should not be any error
+
+		trigger := SentinelTrigger{SentinelPath: sentinel}
+
+		v, err := trigger.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+
+		_, err = os.Stat(sentinel)
+		r.True(os.IsNotExist(err)) // sentinel file should be removed
+	})
+}
+
+func TestMarkerTrigger_Trigger(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no file at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		trigger := MarkerTrigger{Marker: []byte("BEGIN BATCH")}
+
+		// Hopefully this is random
+		randomPath := filepath.Join(dir, "g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn")
+
+		v, err := trigger.Trigger(randomPath, []byte("BEGIN BATCH 1\n"))
+		r.True(err != nil)
+		r.True(v == false)
+	})
+
+	t.Run("bytes without marker", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "marker-trigger-*")
+		err := ioutil.WriteFile(file, []byte("hello world\n"), 0644)
+		r.NoErr(err) // should not be any error
+
+		trigger := MarkerTrigger{Marker: []byte("BEGIN BATCH"), Pattern: regexp.MustCompile(`^batch=\d+`)}
+
+		v, err := trigger.Trigger(file, []byte("record\n"))
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+	})
+
+	t.Run("bytes with marker", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "marker-trigger-*")
+		err := ioutil.WriteFile(file, []byte("hello world\n"), 0644)
+		r.NoErr(err) // should not be any error
+
+		trigger := MarkerTrigger{Marker: []byte("BEGIN BATCH")}
+
+		v, err := trigger.Trigger(file, []byte("BEGIN BATCH 2\n"))
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+	})
+
+	t.Run("bytes matching pattern", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "marker-trigger-*")
+		err := ioutil.WriteFile(file, []byte("hello world\n"), 0644)
+		r.NoErr(err) // should not be any error
+
+		trigger := MarkerTrigger{Pattern: regexp.MustCompile(`^batch=\d+`)}
+
+		v, err := trigger.Trigger(file, []byte("batch=42\n"))
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+	})
+
+	t.Run("bytes with marker and empty file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "marker-trigger-*")
+
+		trigger := MarkerTrigger{Marker: []byte("BEGIN BATCH")}
+
+		v, err := trigger.Trigger(file, []byte("BEGIN BATCH 1\n"))
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false, file already starts with the marker
+	})
+}
+
 type clock struct {
 	time time.Time
 
@@ -223,3 +870,82 @@ func (c *clock) Set(t time.Time) {
 	defer c.mu.Unlock()
 	c.time = t
 }
+
+func TestNotIfEmptyTrigger_Trigger(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "not-if-empty-trigger-*")
+
+		trigger := NotIfEmptyTrigger{FileTrigger: fixedTrigger(true)}
+
+		v, err := trigger.Trigger(file, []byte(testText))
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+	})
+
+	t.Run("non empty file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "not-if-empty-trigger-*")
+		err := ioutil.WriteFile(file, []byte(testText), 0644)
+		r.NoErr(err) // should not be any error
+
+		v, err := NotIfEmptyTrigger{FileTrigger: fixedTrigger(true)}.Trigger(file, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+
+		v, err = NotIfEmptyTrigger{FileTrigger: fixedTrigger(false)}.Trigger(file, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false
+	})
+
+	t.Run("underlying trigger error", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+
+		file := NewFile(t, dir, "not-if-empty-trigger-*")
+
+		v, err := NotIfEmptyTrigger{FileTrigger: SizeBasedTrigger{Size: 1}}.Trigger(file, []byte(testText))
+		r.True(err != nil) // should be non nil
+		r.True(v == false) // trigger should return false
+	})
+
+	t.Run("compressed file", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+
+		file, err := os.Create(filepath.Join(dir, "application.log.gz"))
+		r.NoErr(err) // should not be any error
+		cf, err := NewCompressedFile(file, GzipCodec{})
+		r.NoErr(err) // should not be any error
+		t.Cleanup(func() { _ = cf.Close() })
+		r.NoErr(cf.Flush()) // should not be any error
+
+		trigger := TriggerAdapter{FileTrigger: NotIfEmptyTrigger{FileTrigger: fixedTrigger(true)}}
+
+		v, err := trigger.Trigger(cf, nil)
+		r.NoErr(err)       // should not be any error
+		r.True(v == false) // trigger should return false without uncompressed bytes
+
+		_, err = cf.Write([]byte(testText))
+		r.NoErr(err) // should not be any error
+
+		v, err = trigger.Trigger(cf, nil)
+		r.NoErr(err)      // should not be any error
+		r.True(v == true) // trigger should return true
+	})
+}
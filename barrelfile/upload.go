@@ -0,0 +1,393 @@
+package barrelfile
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UploadTransformer uploads the file to an object storage, or any HTTP
+// endpoint accepting PUT requests, it is expected to be used after the
+// transformers generating the final archive.
+//
+// The file is uploaded by a PUT request to the URL, with name of the file
+// added to its path, and Content-MD5 header for the storage to verify the
+// integrity of the upload. Files larger than PartSize are uploaded in parts
+// with the S3 multipart upload API.
+//
+// Requests failing with network errors, 5xx or 429 status are retried, with
+// exponential backoff, except the request initiating a multipart upload, as
+// its retry could leave an orphaned upload behind.
+//
+// Object storages authenticating the requests by signature, like S3 with
+// SigV4, require Sign, as the signature covers the request and cannot be set
+// by a static Header.
+type UploadTransformer struct {
+	// URL of the bucket or the directory to upload the files to, eg.
+	// https://bucket.s3.amazonaws.com/logs.
+	URL string
+
+	// Client used for the requests. If unset, http.DefaultClient is used.
+	Client *http.Client
+
+	// Header is added to every request, eg. for authorization.
+	Header http.Header
+
+	// Sign is called with every request, including its retries, once all of
+	// its headers are set, eg. to sign it with SigV4 for S3. If unset,
+	// requests are sent as is.
+	Sign func(req *http.Request) error
+
+	// PartSize above which files are uploaded in parts of PartSize bytes,
+	// with the S3 multipart upload API. If unset (ie. 0), files are uploaded
+	// by a single request.
+	PartSize int64
+
+	// Chunked sends the body of single request uploads with chunked transfer
+	// encoding, instead of with Content-Length.
+	Chunked bool
+
+	// MaxAttempts of every request. If unset (ie. 0), it will correspond to 3.
+	MaxAttempts int
+
+	// RetryBackoff is the wait before the first retry, doubled for every
+	// following retry. If unset (ie. 0), it will correspond to 1 second.
+	RetryBackoff time.Duration
+
+	// DeleteAfterUpload removes the file once it is uploaded.
+	DeleteAfterUpload bool
+
+	// Async uploads the file in a separate goroutine, so that Transform
+	// returns immediately, without blocking the writes. Errors are logged to
+	// the Logger. As the file may still be uploaded, or removed after upload,
+	// the transformer should be the last one.
+	Async bool
+
+	// MaxConcurrentUploads is the max number of async uploads in progress,
+	// once reached Transform blocks until an upload completes. If unset (ie.
+	// 0), it will correspond to 4.
+	MaxConcurrentUploads int
+
+	// Logger logs the uploaded files, and errors of async uploads. If unset,
+	// nothing is logged.
+	Logger *log.Logger
+
+	wg      sync.WaitGroup
+	semOnce sync.Once
+	sem     chan struct{}
+}
+
+var _ Transformer = (*UploadTransformer)(nil)
+
+// Transform uploads the file at the given path, or starts uploading it if
+// Async, and removes it after upload if DeleteAfterUpload. The given path is
+// returned unchanged.
+//
+// If Async and MaxConcurrentUploads are in progress, it blocks until one of
+// them completes.
+//
+// If there are any errors while uploading the file then non-nil error is
+// returned.
+func (t *UploadTransformer) Transform(path string) (string, error) {
+	if !t.Async {
+		if err := t.Upload(path); err != nil {
+			return path, err
+		}
+		return path, nil
+	}
+	t.semOnce.Do(func() {
+		maxUploads := t.MaxConcurrentUploads
+		if maxUploads <= 0 {
+			maxUploads = 4
+		}
+		t.sem = make(chan struct{}, maxUploads)
+	})
+	t.sem <- struct{}{}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer func() { <-t.sem }()
+		if err := t.Upload(path); err != nil {
+			logf(t.Logger, "upload: %s: %v", path, err)
+		}
+	}()
+	return path, nil
+}
+
+// Wait waits for the async uploads to complete.
+func (t *UploadTransformer) Wait() {
+	t.wg.Wait()
+}
+
+// Upload uploads the file at the given path, and removes it after upload if
+// DeleteAfterUpload.
+//
+// If there are any errors while uploading the file then non-nil error is
+// returned.
+func (t *UploadTransformer) Upload(path string) error {
+	stat, err := os.Stat(path)
+	if err != nil && os.IsNotExist(err) {
+		return fmt.Errorf("no such file: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("os stat: %w", err)
+	}
+	if stat.IsDir() {
+		return fmt.Errorf("path is of a directory not a file")
+	}
+	objectURL := strings.TrimSuffix(t.URL, "/") + "/" + url.PathEscape(filepath.Base(path))
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("os open: %w", err)
+	}
+	if t.PartSize > 0 && stat.Size() > t.PartSize {
+		err = t.uploadMultipart(objectURL, file, stat.Size())
+	} else {
+		err = t.uploadSingle(objectURL, file, stat.Size())
+	}
+	if cerr := file.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("close file: %w", cerr)
+	}
+	if err != nil {
+		return err
+	}
+	logf(t.Logger, "upload: uploaded %s to %s", path, objectURL)
+
+	if t.DeleteAfterUpload {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("os remove uploaded file: %w", err)
+		}
+	}
+	return nil
+}
+
+// uploadSingle uploads the file by a single PUT request.
+func (t *UploadTransformer) uploadSingle(objectURL string, file *os.File, size int64) error {
+	sum, err := sectionMD5(file, 0, size)
+	if err != nil {
+		return err
+	}
+	_, _, err = t.do(uploadRequest{
+		method:  http.MethodPut,
+		url:     objectURL,
+		body:    func() io.Reader { return io.NewSectionReader(file, 0, size) },
+		size:    size,
+		md5:     sum,
+		chunked: t.Chunked,
+	})
+	if err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+	return nil
+}
+
+// uploadMultipart uploads the file in parts, with the S3 multipart upload API.
+// The upload is aborted on failure.
+func (t *UploadTransformer) uploadMultipart(objectURL string, file *os.File, size int64) error {
+	resp, _, err := t.do(uploadRequest{method: http.MethodPost, url: objectURL + "?uploads", noRetry: true})
+	if err != nil {
+		return fmt.Errorf("initiate multipart upload: %w", err)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp, &initiated); err != nil || len(initiated.UploadID) == 0 {
+		return fmt.Errorf("initiate multipart upload: no upload id in response")
+	}
+	uploadURL := objectURL + "?uploadId=" + url.QueryEscape(initiated.UploadID)
+
+	if err := t.uploadParts(objectURL, uploadURL, initiated.UploadID, file, size); err != nil {
+		if _, _, aerr := t.do(uploadRequest{method: http.MethodDelete, url: uploadURL}); aerr != nil {
+			logf(t.Logger, "upload: abort multipart upload %s: %v", initiated.UploadID, aerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// completedPart is a part of CompleteMultipartUpload request.
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (t *UploadTransformer) uploadParts(objectURL, uploadURL, uploadID string, file *os.File, size int64) error {
+	var parts []completedPart
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+t.PartSize, number+1 {
+		partSize := t.PartSize
+		if offset+partSize > size {
+			partSize = size - offset
+		}
+		sum, err := sectionMD5(file, offset, partSize)
+		if err != nil {
+			return err
+		}
+		partURL := fmt.Sprintf("%s?partNumber=%d&uploadId=%s", objectURL, number, url.QueryEscape(uploadID))
+		offset := offset
+		_, header, err := t.do(uploadRequest{
+			method: http.MethodPut,
+			url:    partURL,
+			body:   func() io.Reader { return io.NewSectionReader(file, offset, partSize) },
+			size:   partSize,
+			md5:    sum,
+		})
+		if err != nil {
+			return fmt.Errorf("upload part %d: %w", number, err)
+		}
+		etag := header.Get("ETag")
+		if len(etag) == 0 {
+			return fmt.Errorf("upload part %d: no etag in response", number)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return fmt.Errorf("xml marshal: %w", err)
+	}
+	resp, _, err := t.do(uploadRequest{
+		method: http.MethodPost,
+		url:    uploadURL,
+		body:   func() io.Reader { return bytes.NewReader(body) },
+		size:   int64(len(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	// S3 may report errors of completion with 200 status.
+	if bytes.Contains(resp, []byte("<Error>")) {
+		return fmt.Errorf("complete multipart upload: %s", resp)
+	}
+	return nil
+}
+
+// uploadRequest describes a request of an upload.
+type uploadRequest struct {
+	method string
+	url    string
+
+	// body returns a new reader of the body for every attempt, nil if the
+	// request has no body.
+	body func() io.Reader
+	size int64
+
+	// md5 is the Content-MD5 of the body, if not empty.
+	md5 string
+
+	// chunked sends the body with chunked transfer encoding.
+	chunked bool
+
+	// noRetry makes a single attempt of the request, for requests not safe
+	// to be repeated.
+	noRetry bool
+}
+
+// do performs the request with retries, and returns the body and the header
+// of the response.
+func (t *UploadTransformer) do(ur uploadRequest) ([]byte, http.Header, error) {
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	maxAttempts := t.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	if ur.noRetry {
+		maxAttempts = 1
+	}
+	backoff := t.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var body io.Reader
+		if ur.body != nil {
+			body = ur.body()
+			if ur.chunked {
+				// hide the concrete type, so that the length is not known.
+				body = struct{ io.Reader }{body}
+			}
+		}
+		req, err := http.NewRequest(ur.method, ur.url, body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("new request: %w", err)
+		}
+		for key, values := range t.Header {
+			req.Header[key] = append([]string(nil), values...)
+		}
+		if ur.body != nil && !ur.chunked {
+			req.ContentLength = ur.size
+		}
+		if len(ur.md5) != 0 {
+			req.Header.Set("Content-MD5", ur.md5)
+		}
+		if t.Sign != nil {
+			if err := t.Sign(req); err != nil {
+				return nil, nil, fmt.Errorf("sign request: %w", err)
+			}
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			lastErr = fmt.Errorf("read response: %w", err)
+			continue
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return data, resp.Header, nil
+		}
+		lastErr = &uploadStatusError{StatusCode: resp.StatusCode, Body: string(data)}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			break
+		}
+	}
+	return nil, nil, lastErr
+}
+
+// uploadStatusError is the error of a request failing with non 2xx status.
+type uploadStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *uploadStatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+// sectionMD5 returns the base64 encoded MD5 digest of the section of the file,
+// as used by Content-MD5 header.
+func sectionMD5(file *os.File, offset, size int64) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, offset, size)); err != nil {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,397 @@
+package barrelfile
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// objectStorage is an in memory stand-in of an S3 compatible object storage.
+type objectStorage struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte
+	failures int // number of requests to fail with 503
+	aborted  int
+	chunked  bool
+}
+
+func newObjectStorage(t *testing.T) (*objectStorage, *httptest.Server) {
+	s := &objectStorage{objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func (s *objectStorage) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		http.Error(w, "slow down", http.StatusServiceUnavailable)
+		return
+	}
+	if req.Header.Get("Authorization") != "token" {
+		http.Error(w, "unauthorized", http.StatusForbidden)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sum := req.Header.Get("Content-MD5"); sum != "" {
+		actual := md5.Sum(body)
+		if sum != base64.StdEncoding.EncodeToString(actual[:]) {
+			http.Error(w, "bad digest", http.StatusBadRequest)
+			return
+		}
+	}
+	query := req.URL.Query()
+	key := req.URL.Path
+	switch {
+	case req.Method == http.MethodPost && hasQuery(query, "uploads"):
+		id := fmt.Sprintf("upload-%d", len(s.uploads)+1)
+		s.uploads[id] = make(map[int][]byte)
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case req.Method == http.MethodPut && query.Get("uploadId") != "":
+		var number int
+		_, _ = fmt.Sscan(query.Get("partNumber"), &number)
+		s.uploads[query.Get("uploadId")][number] = body
+		w.Header().Set("ETag", fmt.Sprintf("%q", fmt.Sprintf("etag-%d", number)))
+	case req.Method == http.MethodPost && query.Get("uploadId") != "":
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var object []byte
+		for _, part := range complete.Parts {
+			object = append(object, s.uploads[query.Get("uploadId")][part.PartNumber]...)
+		}
+		s.objects[key] = object
+	case req.Method == http.MethodDelete && query.Get("uploadId") != "":
+		delete(s.uploads, query.Get("uploadId"))
+		s.aborted++
+	case req.Method == http.MethodPut:
+		s.chunked = len(req.TransferEncoding) != 0
+		s.objects[key] = body
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *objectStorage) object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[key]
+	return object, ok
+}
+
+func TestUploadTransformer_Transform(t *testing.T) {
+	t.Parallel()
+
+	header := http.Header{"Authorization": []string{"token"}}
+
+	// setupFile creates the file application.log.1.gz with the given content
+	// in a new directory.
+	setupFile := func(t *testing.T, content string) string {
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+		NewFiles(t, dir, content, "application.log.1.gz")
+		return filepath.Join(dir, "application.log.1.gz")
+	}
+
+	t.Run("no file at path", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, server := newObjectStorage(t)
+		dir := SetupDir(t)
+
+		// Hopefully this is random
+		randomPath := filepath.Join(dir, "g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn.g3t4c5x15nx3k0fs3125nl400000gn")
+
+		path, err := (&UploadTransformer{URL: server.URL, Header: header}).Transform(randomPath)
+		r.True(err != nil)         // should be non nil
+		r.True(path == randomPath) // path returned should be same as given path
+	})
+
+	t.Run("single request upload", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		storage, server := newObjectStorage(t)
+		file := setupFile(t, testText)
+
+		path, err := (&UploadTransformer{URL: server.URL + "/logs/", Header: header}).Transform(file)
+		r.NoErr(err)        // should not be any error
+		r.Equal(path, file) // path should be unchanged
+
+		object, ok := storage.object("/logs/application.log.1.gz")
+		r.True(ok)                        // object should be uploaded
+		r.Equal(string(object), testText) // object should have content of file
+		r.True(!storage.chunked)          // body should be sent with content length
+
+		_, err = os.Stat(file)
+		r.NoErr(err) // file should not be removed
+	})
+
+	t.Run("chunked upload", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		storage, server := newObjectStorage(t)
+		file := setupFile(t, testText)
+
+		_, err := (&UploadTransformer{URL: server.URL, Header: header, Chunked: true}).Transform(file)
+		r.NoErr(err) // should not be any error
+
+		object, _ := storage.object("/application.log.1.gz")
+		r.Equal(string(object), testText) // object should have content of file
+		r.True(storage.chunked)           // body should be sent with chunked transfer encoding
+	})
+
+	t.Run("multipart upload", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		storage, server := newObjectStorage(t)
+		file := setupFile(t, testText)
+
+		_, err := (&UploadTransformer{URL: server.URL, Header: header, PartSize: 100}).Transform(file)
+		r.NoErr(err) // should not be any error
+
+		object, _ := storage.object("/application.log.1.gz")
+		r.Equal(string(object), testText)                              // parts should be assembled in order
+		r.Equal(len(storage.uploads["upload-1"]), len(testText)/100+1) // file should be uploaded in parts
+	})
+
+	t.Run("failed multipart upload is aborted", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		storage, server := newObjectStorage(t)
+		file := setupFile(t, testText)
+
+		// parts are uploaded without authorization
+		var requests int
+		client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			requests++
+			if requests > 1 && req.Method == http.MethodPut {
+				req.Header.Del("Authorization")
+			}
+			return http.DefaultTransport.RoundTrip(req)
+		})}
+
+		_, err := (&UploadTransformer{URL: server.URL, Header: header, PartSize: 100, Client: client}).Transform(file)
+		r.True(err != nil)          // should be non nil
+		r.Equal(storage.aborted, 1) // upload should be aborted
+		r.Equal(requests, 3)        // client errors should not be retried
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		storage, server := newObjectStorage(t)
+		storage.failures = 2
+		file := setupFile(t, testText)
+
+		_, err := (&UploadTransformer{URL: server.URL, Header: header, RetryBackoff: time.Millisecond}).Transform(file)
+		r.NoErr(err) // should not be any error
+
+		_, ok := storage.object("/application.log.1.gz")
+		r.True(ok) // object should be uploaded after retries
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		storage, server := newObjectStorage(t)
+		storage.failures = 3
+		file := setupFile(t, testText)
+
+		path, err := (&UploadTransformer{URL: server.URL, Header: header, RetryBackoff: time.Millisecond}).Transform(file)
+		r.True(err != nil)                                  // should be non nil
+		r.True(strings.Contains(err.Error(), "status 503")) // error should have status
+		r.Equal(path, file)                                 // path returned should be same as given path
+	})
+
+	t.Run("multipart upload initiate is not retried", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		storage, server := newObjectStorage(t)
+		storage.failures = 1
+		file := setupFile(t, testText)
+
+		var requests int
+		client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			requests++
+			return http.DefaultTransport.RoundTrip(req)
+		})}
+
+		_, err := (&UploadTransformer{URL: server.URL, Header: header, PartSize: 100, Client: client, RetryBackoff: time.Millisecond}).Transform(file)
+		r.True(err != nil)   // should be non nil
+		r.Equal(requests, 1) // initiate should not be retried
+	})
+
+	t.Run("signed requests", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		storage, server := newObjectStorage(t)
+		storage.failures = 1
+		file := setupFile(t, testText)
+
+		var signed int
+		sign := func(req *http.Request) error {
+			signed++
+			r.True(req.Header.Get("Content-MD5") != "") // headers should be set before signing
+			req.Header.Set("Authorization", "token")
+			return nil
+		}
+
+		_, err := (&UploadTransformer{URL: server.URL, Sign: sign, RetryBackoff: time.Millisecond}).Transform(file)
+		r.NoErr(err)       // should not be any error
+		r.Equal(signed, 2) // every attempt should be signed
+
+		_, ok := storage.object("/application.log.1.gz")
+		r.True(ok) // object should be uploaded
+
+		_, err = (&UploadTransformer{URL: server.URL, Sign: func(*http.Request) error { return fmt.Errorf("no credentials") }}).Transform(file)
+		r.True(err != nil) // sign errors should be non nil
+	})
+
+	t.Run("delete after upload", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		storage, server := newObjectStorage(t)
+		file := setupFile(t, testText)
+
+		_, err := (&UploadTransformer{URL: server.URL, Header: header, DeleteAfterUpload: true}).Transform(file)
+		r.NoErr(err) // should not be any error
+
+		_, ok := storage.object("/application.log.1.gz")
+		r.True(ok) // object should be uploaded
+		_, err = os.Stat(file)
+		r.True(os.IsNotExist(err)) // file should be removed after upload
+	})
+
+	t.Run("async upload", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		storage, server := newObjectStorage(t)
+		file := setupFile(t, testText)
+
+		release := make(chan struct{})
+		client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			<-release
+			return http.DefaultTransport.RoundTrip(req)
+		})}
+
+		transformer := &UploadTransformer{URL: server.URL, Header: header, Client: client, Async: true}
+		path, err := transformer.Transform(file)
+		r.NoErr(err)        // should not be any error
+		r.Equal(path, file) // path should be unchanged
+
+		_, ok := storage.object("/application.log.1.gz")
+		r.True(!ok) // transform should not wait for the upload
+
+		close(release)
+		transformer.Wait()
+
+		_, ok = storage.object("/application.log.1.gz")
+		r.True(ok) // object should be uploaded
+	})
+
+	t.Run("async uploads are bounded", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, server := newObjectStorage(t)
+		dir := SetupDir(t)
+		CleanupDir(t, dir)
+
+		var mu sync.Mutex
+		var inFlight, maxInFlight int
+		client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			defer func() {
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}()
+			return http.DefaultTransport.RoundTrip(req)
+		})}
+
+		transformer := &UploadTransformer{URL: server.URL, Header: header, Client: client, Async: true, MaxConcurrentUploads: 2}
+		for i := 0; i < 6; i++ {
+			name := fmt.Sprintf("application.log.%d.gz", i+1)
+			NewFiles(t, dir, testText, name)
+			_, err := transformer.Transform(filepath.Join(dir, name))
+			r.NoErr(err) // should not be any error
+		}
+		transformer.Wait()
+
+		r.True(maxInFlight <= 2) // uploads in progress should not exceed max
+	})
+
+	t.Run("async upload errors are logged", func(t *testing.T) {
+		t.Parallel()
+		r := is.New(t)
+
+		_, server := newObjectStorage(t)
+		file := setupFile(t, testText)
+
+		var logs bytes.Buffer
+		transformer := &UploadTransformer{URL: server.URL, Async: true, Logger: log.New(&logs, "", 0)}
+		_, err := transformer.Transform(file)
+		r.NoErr(err) // should not be any error
+		transformer.Wait()
+
+		r.True(strings.Contains(logs.String(), "status 403")) // error should be logged
+	})
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func hasQuery(query url.Values, key string) bool {
+	_, ok := query[key]
+	return ok
+}
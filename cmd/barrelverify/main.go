@@ -0,0 +1,73 @@
+// Command barrelverify verifies archives against the checksums recorded by
+// barrelfile.ChecksumTransformer.
+//
+// Usage:
+//
+//	barrelverify [-manifest] [-ignore-missing] path...
+//
+// By default every path is an archive, verified against its sidecar files.
+// With -manifest every path is a manifest, whose listed archives are verified.
+// Archives which fail verification are reported, and the exit status is 1.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hemantjadon/barrel/barrelfile"
+)
+
+func main() {
+	manifest := flag.Bool("manifest", false, "verify the archives listed in the given manifests")
+	ignoreMissing := flag.Bool("ignore-missing", false, "do not fail for archives listed in manifests which no longer exist")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: barrelverify [-manifest] [-ignore-missing] path...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ok := true
+	for _, path := range flag.Args() {
+		if *manifest {
+			ok = verifyManifest(path, *ignoreMissing) && ok
+			continue
+		}
+		if err := barrelfile.VerifyChecksum(path); err != nil {
+			fmt.Printf("%s: FAILED: %v\n", path, err)
+			ok = false
+			continue
+		}
+		fmt.Printf("%s: OK\n", path)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// verifyManifest verifies the archives listed in the manifest at the given
+// path, and reports whether all of them are verified.
+func verifyManifest(path string, ignoreMissing bool) bool {
+	failures, missing, err := barrelfile.VerifyManifest(path)
+	if err != nil {
+		fmt.Printf("%s: FAILED: %v\n", path, err)
+		return false
+	}
+	for _, failure := range failures {
+		fmt.Printf("%s: FAILED: %v\n", failure.Path, failure.Err)
+	}
+	if !ignoreMissing {
+		for _, archive := range missing {
+			fmt.Printf("%s: FAILED: missing\n", archive)
+		}
+	}
+	if len(failures) == 0 && (ignoreMissing || len(missing) == 0) {
+		fmt.Printf("%s: OK\n", path)
+		return true
+	}
+	return false
+}